@@ -0,0 +1,258 @@
+// Package build builds container images from source using pluggable backends.
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+
+	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/registry"
+)
+
+// Backend names
+const (
+	Auto       = "auto"
+	Buildpacks = "buildpacks"
+	Dockerfile = "dockerfile"
+)
+
+// DefaultDockerfile is the name of the Dockerfile looked up in the build context
+const DefaultDockerfile = "Dockerfile"
+
+// Options are the options of a build
+type Options struct {
+	// Image is the reference of the resulting image
+	Image string
+	// Context is the path to the build context
+	Context string
+	// Env are the build-time environment variables of a buildpacks build
+	Env map[string]string
+	// Builder is the buildpacks builder
+	Builder string
+	// Dockerfile is the path to the Dockerfile relative to the context
+	Dockerfile string
+	// BuildArgs are the build arguments of a Dockerfile build
+	BuildArgs map[string]string
+	// Target is the target stage of a Dockerfile build
+	Target string
+	// Tags are additional references of the resulting image
+	Tags []string
+	// ClearCache starts the build from a clean cache
+	ClearCache bool
+	// CacheImage is the image used as a shared build cache
+	CacheImage string
+	// Publish pushes the tags of the image to the registry as part of the build, and buildpacks
+	// builds push the image itself too
+	Publish bool
+	// PreviousImage is the image whose layers are reused by a buildpacks build
+	PreviousImage string
+	// Labels are set on the image. Buildpacks builds pass them in BP_IMAGE_LABELS for the builders
+	// with the Paketo image labels buildpack, and add them to the built image for the others.
+	Labels map[string]string
+}
+
+// Result is the outcome of a successful build
+type Result struct {
+	// Backend is the name of the backend that built the image
+	Backend string
+	// Image is the reference of the built image
+	Image string
+}
+
+// Backend builds images. Backends write the combined output of the build to the progress writer.
+type Backend interface {
+	// Name returns the name of the backend
+	Name() string
+	// Build builds the image
+	Build(ctx context.Context, opts Options, progress io.Writer) (*Result, error)
+}
+
+// New returns the backend by name. The auto backend is resolved using Detect.
+func New(name string, opts Options) (Backend, error) {
+	if name == "" || name == Auto {
+		name = Detect(opts)
+	}
+	switch name {
+	case Buildpacks:
+		return &BuildpacksBackend{}, nil
+	case Dockerfile:
+		return &DockerfileBackend{}, nil
+	}
+	return nil, errors.Errorf("unknown build backend %q, expected one of %s, %s or %s", name, Auto, Buildpacks, Dockerfile)
+}
+
+// Detect returns the dockerfile backend when the context contains a Dockerfile, and the
+// buildpacks backend otherwise
+func Detect(opts Options) string {
+	dockerfile := opts.Dockerfile
+	if dockerfile == "" {
+		dockerfile = DefaultDockerfile
+	}
+	if _, err := os.Stat(filepath.Join(opts.Context, dockerfile)); err == nil {
+		return Dockerfile
+	}
+	return Buildpacks
+}
+
+// BuildpacksBackend builds images with Cloud Native Buildpacks using the pack CLI
+type BuildpacksBackend struct{}
+
+// Name returns the name of the backend
+func (b *BuildpacksBackend) Name() string {
+	return Buildpacks
+}
+
+// Build builds the image using pack build
+func (b *BuildpacksBackend) Build(ctx context.Context, opts Options, progress io.Writer) (*Result, error) {
+	if opts.Builder == "" {
+		return nil, errors.New("builder is required to build with buildpacks")
+	}
+	c := []string{"build", opts.Image, "--builder", opts.Builder, "--path", opts.Context}
+	for _, k := range sortedKeys(opts.Env) {
+		c = append(c, "--env", k+"="+opts.Env[k])
+	}
+	if len(opts.Labels) > 0 {
+		labels := make([]string, 0, len(opts.Labels))
+		for _, k := range sortedKeys(opts.Labels) {
+			labels = append(labels, k+"="+strconv.Quote(opts.Labels[k]))
+		}
+		c = append(c, "--env", "BP_IMAGE_LABELS="+strings.Join(labels, " "))
+	}
+	for _, tag := range opts.Tags {
+		c = append(c, "--tag", tag)
+	}
+	if opts.ClearCache {
+		c = append(c, "--clear-cache")
+	}
+	if opts.CacheImage != "" {
+		c = append(c, "--cache-image", opts.CacheImage)
+	}
+	if opts.Publish {
+		c = append(c, "--publish")
+	}
+	if opts.PreviousImage != "" {
+		c = append(c, "--previous-image", opts.PreviousImage)
+	}
+	if err := run(ctx, progress, "pack", c...); err != nil {
+		return nil, err
+	}
+	if err := applyLabels(ctx, opts, progress); err != nil {
+		return nil, err
+	}
+	return &Result{Backend: Buildpacks, Image: opts.Image}, nil
+}
+
+// applyLabels adds the labels to the built image and its tags, in the registry when the build published
+// it and in the docker daemon otherwise, unless the builder already set them
+func applyLabels(ctx context.Context, opts Options, progress io.Writer) error {
+	if len(opts.Labels) == 0 {
+		return nil
+	}
+	var img v1.Image
+	var err error
+	client := registry.New(registry.Options{})
+	if opts.Publish {
+		img, err = client.Image(ctx, opts.Image)
+	} else {
+		img, err = registry.Local(ctx, opts.Image)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read the built image to label it")
+	}
+	labeled, changed, err := registry.WithLabels(img, opts.Labels)
+	if err != nil || !changed {
+		return err
+	}
+	fmt.Fprintf(progress, "The builder ignored BP_IMAGE_LABELS, labeling %s\n", opts.Image)
+	if !opts.Publish {
+		return registry.Load(ctx, labeled, opts.Image, opts.Tags...)
+	}
+	// pack pushed the image itself too, it is labeled after the versioned tags
+	for _, ref := range append(append([]string{}, opts.Tags...), opts.Image) {
+		if _, err := client.Push(ctx, labeled, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DockerfileBackend builds images from a Dockerfile using docker build
+type DockerfileBackend struct{}
+
+// Name returns the name of the backend
+func (b *DockerfileBackend) Name() string {
+	return Dockerfile
+}
+
+// Build builds the image using docker build
+func (b *DockerfileBackend) Build(ctx context.Context, opts Options, progress io.Writer) (*Result, error) {
+	if len(opts.Env) > 0 {
+		logger.Warn("build-time environment variables are ignored by Dockerfile builds, use build arguments instead")
+	}
+	c := []string{"build", "--tag", opts.Image}
+	for _, tag := range opts.Tags {
+		c = append(c, "--tag", tag)
+	}
+	if opts.ClearCache {
+		c = append(c, "--no-cache")
+	}
+	if opts.CacheImage != "" {
+		c = append(c, "--cache-from", opts.CacheImage)
+	}
+	if opts.Dockerfile != "" {
+		c = append(c, "--file", filepath.Join(opts.Context, opts.Dockerfile))
+	}
+	if opts.Target != "" {
+		c = append(c, "--target", opts.Target)
+	}
+	for _, k := range sortedKeys(opts.BuildArgs) {
+		c = append(c, "--build-arg", k+"="+opts.BuildArgs[k])
+	}
+	for _, k := range sortedKeys(opts.Labels) {
+		c = append(c, "--label", k+"="+opts.Labels[k])
+	}
+	c = append(c, opts.Context)
+	if err := run(ctx, progress, "docker", c...); err != nil {
+		return nil, err
+	}
+	// the image itself is pushed as latest by the publish after the versioned tags
+	if opts.Publish {
+		for _, ref := range opts.Tags {
+			if err := run(ctx, progress, "docker", "push", ref); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Result{Backend: Dockerfile, Image: opts.Image}, nil
+}
+
+// run runs the command and writes its combined output to the progress writer
+func run(ctx context.Context, progress io.Writer, name string, args ...string) error {
+	logger.Debugf("build: running command: %s %s", name, strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = progress
+	cmd.Stderr = progress
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "error running %s", name)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,36 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	if got := Detect(Options{Context: dir}); got != Buildpacks {
+		t.Fatalf("expected %s without a Dockerfile, got %s", Buildpacks, got)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "build.Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Detect(Options{Context: dir}); got != Buildpacks {
+		t.Fatalf("expected %s with a Dockerfile of another name, got %s", Buildpacks, got)
+	}
+	if got := Detect(Options{Context: dir, Dockerfile: "build.Dockerfile"}); got != Dockerfile {
+		t.Fatalf("expected %s, got %s", Dockerfile, got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	b, err := New(Auto, Options{Context: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != Buildpacks {
+		t.Fatalf("expected %s, got %s", Buildpacks, b.Name())
+	}
+	if _, err := New("kaniko", Options{}); err == nil {
+		t.Fatal("expected an error for an unknown backend")
+	}
+}
@@ -0,0 +1,145 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Languages detected in a project
+const (
+	LangGo     = "go"
+	LangNode   = "nodejs"
+	LangPython = "python"
+	LangRuby   = "ruby"
+	LangJava   = "java"
+	LangPHP    = "php"
+	LangDotNet = "dotnet"
+	LangStatic = "static"
+)
+
+// BuilderInfo describes a well known buildpacks builder
+type BuilderInfo struct {
+	Image       string
+	Description string
+	Languages   []string
+}
+
+// Supports returns true if the builder supports all of the languages
+func (b BuilderInfo) Supports(langs []string) bool {
+	for _, l := range langs {
+		found := false
+		for _, s := range b.Languages {
+			if s == l {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// KnownBuilders are the well known builders in order of preference
+var KnownBuilders = []BuilderInfo{
+	{
+		Image:       "heroku/buildpacks:20",
+		Description: "Heroku builder based on Ubuntu 20.04",
+		Languages:   []string{LangGo, LangNode, LangPython, LangRuby, LangJava, LangPHP},
+	},
+	{
+		Image:       "heroku/builder:22",
+		Description: "Heroku builder based on Ubuntu 22.04",
+		Languages:   []string{LangGo, LangNode, LangPython, LangRuby, LangJava, LangPHP},
+	},
+	{
+		Image:       "paketobuildpacks/builder:base",
+		Description: "Paketo builder for common languages based on Ubuntu bionic",
+		Languages:   []string{LangGo, LangNode, LangRuby, LangJava, LangPHP, LangDotNet, LangStatic},
+	},
+	{
+		Image:       "paketobuildpacks/builder:full",
+		Description: "Paketo builder with the most system libraries based on Ubuntu bionic",
+		Languages:   []string{LangGo, LangNode, LangPython, LangRuby, LangJava, LangPHP, LangDotNet, LangStatic},
+	},
+	{
+		Image:       "paketobuildpacks/builder:tiny",
+		Description: "Paketo builder producing distroless-like images for compiled apps",
+		Languages:   []string{LangGo, LangJava},
+	},
+	{
+		Image:       "gcr.io/buildpacks/builder:v1",
+		Description: "Google Cloud builder based on Ubuntu 18.04",
+		Languages:   []string{LangGo, LangNode, LangPython, LangRuby, LangJava, LangPHP, LangDotNet},
+	},
+}
+
+// languageFiles maps the files found at the root of a project to its language
+var languageFiles = []struct {
+	pattern string
+	lang    string
+}{
+	{"go.mod", LangGo},
+	{"package.json", LangNode},
+	{"requirements.txt", LangPython},
+	{"Pipfile", LangPython},
+	{"pyproject.toml", LangPython},
+	{"Gemfile", LangRuby},
+	{"pom.xml", LangJava},
+	{"build.gradle", LangJava},
+	{"build.gradle.kts", LangJava},
+	{"composer.json", LangPHP},
+	{"*.csproj", LangDotNet},
+	{"*.fsproj", LangDotNet},
+	{"index.html", LangStatic},
+}
+
+// DetectLanguages returns the languages of the project at dir, based on the files at its root
+func DetectLanguages(dir string) []string {
+	var langs []string
+	seen := map[string]bool{}
+	for _, lf := range languageFiles {
+		matches, _ := filepath.Glob(filepath.Join(dir, lf.pattern))
+		if len(matches) == 0 || seen[lf.lang] {
+			continue
+		}
+		seen[lf.lang] = true
+		langs = append(langs, lf.lang)
+	}
+	return langs
+}
+
+// Suggest returns the known builders that support all the languages of the project at dir in
+// order of preference. It returns nil when the project has a Dockerfile, which the dockerfile
+// backend builds instead, or when no language is detected.
+func Suggest(dir string) []BuilderInfo {
+	if _, err := os.Stat(filepath.Join(dir, DefaultDockerfile)); err == nil {
+		return nil
+	}
+	langs := DetectLanguages(dir)
+	if len(langs) == 0 {
+		return nil
+	}
+	var out []BuilderInfo
+	for _, b := range KnownBuilders {
+		if b.Supports(langs) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// SuggestBuilders returns the builder suggested for the build context of each service, or fallback
+// when no known builder supports it. A single builder can be pinned for the project only when there is
+// a single service, as the builders of several services may differ.
+func SuggestBuilders(contexts map[string]string, fallback string) (builders map[string]string, pin bool) {
+	builders = map[string]string{}
+	for name, dir := range contexts {
+		builders[name] = fallback
+		if suggested := Suggest(dir); len(suggested) > 0 {
+			builders[name] = suggested[0].Image
+		}
+	}
+	return builders, len(builders) == 1
+}
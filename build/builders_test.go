@@ -0,0 +1,67 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	cases := []struct {
+		name   string
+		files  []string
+		langs  []string
+		expect string
+	}{
+		{"empty", nil, nil, ""},
+		{"go", []string{"go.mod"}, []string{LangGo}, "heroku/buildpacks:20"},
+		{"dotnet", []string{"app.csproj"}, []string{LangDotNet}, "paketobuildpacks/builder:base"},
+		{"python and node", []string{"package.json", "requirements.txt"}, []string{LangNode, LangPython}, "heroku/buildpacks:20"},
+		{"dockerfile", []string{"go.mod", "Dockerfile"}, []string{LangGo}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range tc.files {
+				if err := os.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := DetectLanguages(dir); !reflect.DeepEqual(got, tc.langs) {
+				t.Fatalf("expected languages %v, got %v", tc.langs, got)
+			}
+			got := ""
+			if s := Suggest(dir); len(s) > 0 {
+				got = s[0].Image
+			}
+			if got != tc.expect {
+				t.Fatalf("expected %q, got %q", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestSuggestBuilders(t *testing.T) {
+	api, web := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(api, "go.mod"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(web, "app.csproj"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	builders, pin := SuggestBuilders(map[string]string{"api": api, "web": web, "docs": t.TempDir()}, "fallback")
+	expect := map[string]string{"api": "heroku/buildpacks:20", "web": "paketobuildpacks/builder:base", "docs": "fallback"}
+	if !reflect.DeepEqual(builders, expect) {
+		t.Fatalf("expected %v, got %v", expect, builders)
+	}
+	if pin {
+		t.Fatal("expected no builder to be pinned for several services")
+	}
+
+	builders, pin = SuggestBuilders(map[string]string{"web": web}, "fallback")
+	if !pin || builders["web"] != "paketobuildpacks/builder:base" {
+		t.Fatalf("expected the builder of the single service to be pinned, got %v, %v", builders, pin)
+	}
+}
@@ -0,0 +1,74 @@
+package build
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Procfile is the name of the file that declares the process types of an app
+const Procfile = "Procfile"
+
+// Process is a process type of an app, such as web or worker
+type Process struct {
+	Type    string
+	Command string
+}
+
+var procfileLine = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+
+// serviceNamePattern is the grammar of SDL service names, DNS labels
+var serviceNamePattern = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ParseProcfile parses the process types of the Procfile in order of declaration
+func ParseProcfile(r io.Reader) ([]Process, error) {
+	var procs []Process
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := procfileLine.FindStringSubmatch(line)
+		if m == nil {
+			return nil, errors.Errorf("line %d: expected the form 'type: command'", n)
+		}
+		if seen[m[1]] {
+			return nil, errors.Errorf("line %d: process type %s declared twice", n, m[1])
+		}
+		seen[m[1]] = true
+		procs = append(procs, Process{Type: m[1], Command: strings.TrimSpace(m[2])})
+	}
+	return procs, scanner.Err()
+}
+
+// ReadProcfile reads the Procfile in dir, it returns no processes when the file is missing
+func ReadProcfile(dir string) ([]Process, error) {
+	f, err := os.Open(filepath.Join(dir, Procfile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	procs, err := ParseProcfile(f)
+	return procs, errors.Wrap(err, Procfile)
+}
+
+// ServiceName returns the name of the SDL service that runs the process type of the service, such as
+// web-worker. Process types are lowercased and underscores become dashes, as service names are DNS
+// labels.
+func (p Process) ServiceName(service string) (string, error) {
+	name := service + "-" + strings.ToLower(strings.ReplaceAll(p.Type, "_", "-"))
+	if !serviceNamePattern.MatchString(name) {
+		return "", errors.Errorf("process type %s of service %s gives the invalid service name %q, service names are lowercase DNS labels of at most 63 characters", p.Type, service, name)
+	}
+	return name, nil
+}
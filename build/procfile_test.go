@@ -0,0 +1,51 @@
+package build
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProcfile(t *testing.T) {
+	procs, err := ParseProcfile(strings.NewReader("# processes\nweb: bundle exec puma -p $PORT\n\nworker:bundle exec sidekiq\nrelease-tasks: ./migrate.sh\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Process{
+		{Type: "web", Command: "bundle exec puma -p $PORT"},
+		{Type: "worker", Command: "bundle exec sidekiq"},
+		{Type: "release-tasks", Command: "./migrate.sh"},
+	}
+	if !reflect.DeepEqual(procs, expect) {
+		t.Fatalf("expected %+v, got %+v", expect, procs)
+	}
+
+	for _, in := range []string{"web bundle exec puma", "web: a\nweb: b", "web:"} {
+		if _, err := ParseProcfile(strings.NewReader(in)); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestProcess_ServiceName(t *testing.T) {
+	cases := map[string]string{
+		"worker":       "web-worker",
+		"Worker_Queue": "web-worker-queue",
+		"release-2":    "web-release-2",
+	}
+	for typ, expect := range cases {
+		got, err := Process{Type: typ}.ServiceName("web")
+		if err != nil {
+			t.Errorf("%s: %v", typ, err)
+			continue
+		}
+		if got != expect {
+			t.Errorf("%s: expected %s, got %s", typ, expect, got)
+		}
+	}
+	for _, typ := range []string{"worker-", strings.Repeat("a", 60)} {
+		if _, err := (Process{Type: typ}).ServiceName("web"); err == nil {
+			t.Errorf("expected an error for %q", typ)
+		}
+	}
+}
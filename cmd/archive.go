@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ovrclk/eve/registry"
+)
+
+const (
+	// archiveMetadataFile is the file of the eve metadata in an archive
+	archiveMetadataFile = "eve/metadata.json"
+	// archiveReleaseDir is the directory of the release history of the version in an archive
+	archiveReleaseDir = "eve/release"
+)
+
+// archiveMetadata is the eve metadata of the images of an archive
+type archiveMetadata struct {
+	Version     string    `json:"version"`
+	Environment string    `json:"environment,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// LoadFlags contains the flags for the load command
+type LoadFlags struct {
+	Push  bool
+	Force bool
+}
+
+// NewLoad creates a new command that loads the images of an archive written by publish --to-archive
+func NewLoad(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &LoadFlags{}
+	cmd := &cobra.Command{
+		Use:   "load <archive>",
+		Short: "Load the images of an archive written by eve publish --to-archive",
+		Long: `Load the images of an archive written by eve publish --to-archive, such as one moved from a build
+machine that cannot reach the registry.
+
+The images are loaded into the local docker daemon, ready for eve publish. With --push, they are
+pushed to the registry with the publish tags and mirrors instead, and the version and its release
+history, with the provenance and the signatures stored with --storage state, are recorded.`,
+		Example: "eve load web-1.0.0.tar --push",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runLoad(ctx, cancel, args[0], flags)
+		},
+	}
+	cmd.Flags().BoolVar(&flags.Push, "push", false, "Push the images to the registry instead of loading them into the docker daemon")
+	cmd.Flags().BoolVar(&flags.Force, "force", false, "Overwrite the version if it was already published")
+	return cmd
+}
+
+// runPublishArchive writes the local images of the services and the release history of the version to
+// the archive, the version is released as when it is pushed
+func runPublishArchive(ctx context.Context, cancel context.CancelFunc, services []*Service, flags *PublishFlags) error {
+	if !flags.Force {
+		if err := checkVersionUnreleased(flags.Version); err != nil {
+			return err
+		}
+	}
+	var images []*registry.ArchiveImage
+	digests := map[string]string{}
+	for _, svc := range services {
+		img, err := registry.Local(ctx, svc.Image)
+		if err != nil {
+			return errors.Wrap(err, "the images are read from the docker daemon, build them with eve pack")
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the digest of %s", svc.Image)
+		}
+		digests[svc.Name] = digest.String()
+		images = append(images, &registry.ArchiveImage{Service: svc.Name, Ref: svc.Image + ":" + flags.Version, Image: img})
+	}
+
+	if err := releaseProvenance(flags.Version); err != nil {
+		return err
+	}
+	for _, svc := range services {
+		if err := recordDigest(flags.Version, svc, digests[svc.Name]); err != nil {
+			return errors.Wrapf(err, "failed to record the digest of service %s", svc.Name)
+		}
+	}
+	files, err := archiveFiles(flags.Version)
+	if err != nil {
+		return err
+	}
+	err = runPhase("Archiving", "archive", func(w io.Writer) (string, error) {
+		for _, img := range images {
+			fmt.Fprintf(w, "Adding %s\n", img.Ref)
+		}
+		if err := registry.WriteArchive(flags.ToArchive, images, files); err != nil {
+			return "", err
+		}
+		return "Archiving Complete. Wrote " + flags.ToArchive, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !flags.SkipSave {
+		if err := writevar("VERSION", flags.Version); err != nil {
+			return errors.Wrap(err, "failed to write VERSION variable")
+		}
+	}
+
+	tab := uitable.New().AddRow("SERVICE", "IMAGE", "DIGEST")
+	for _, img := range images {
+		tab.AddRow(img.Service, img.Ref, digests[img.Service])
+	}
+	fmt.Println(tab.String())
+	return nil
+}
+
+// archiveFiles returns the eve metadata and the release history of the version by archive path
+func archiveFiles(version string) (map[string][]byte, error) {
+	meta, err := json.MarshalIndent(archiveMetadata{
+		Version:     version,
+		Environment: globalFlags.Environment,
+		CreatedAt:   time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{archiveMetadataFile: meta}
+	dir := releaseDir(version)
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[path.Join(archiveReleaseDir, filepath.ToSlash(rel))] = b
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the release history")
+	}
+	return files, nil
+}
+
+func runLoad(ctx context.Context, cancel context.CancelFunc, p string, flags *LoadFlags) error {
+	a, err := registry.ReadArchive(p)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	var meta archiveMetadata
+	b, ok := a.Files[archiveMetadataFile]
+	if !ok {
+		return errors.Errorf("%s is not an eve archive, %s is missing", p, archiveMetadataFile)
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return errors.Wrapf(err, "failed to decode %s", archiveMetadataFile)
+	}
+	version := meta.Version
+
+	// the images are published to the repositories of the services of this project
+	services, err := projectServices("")
+	if err != nil {
+		return err
+	}
+	images := map[string]*registry.ArchiveImage{}
+	for _, img := range a.Images {
+		images[img.Service] = img
+	}
+	for _, svc := range services {
+		if _, ok := images[svc.Name]; !ok {
+			return errors.Errorf("%s has no image for service %s", p, svc.Name)
+		}
+	}
+
+	if !flags.Push {
+		for _, svc := range services {
+			svc := svc
+			err := runPhase("Loading "+svc.Name, "load-"+svc.Name, func(w io.Writer) (string, error) {
+				fmt.Fprintf(w, "Loading %s as %s:%s\n", images[svc.Name].Ref, svc.Image, version)
+				if err := registry.Load(ctx, images[svc.Name].Image, svc.Image+":"+version, svc.Image); err != nil {
+					return "", err
+				}
+				return "Loading Complete. Image ready " + svc.Image + ":" + version, nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to load service %s", svc.Name)
+			}
+		}
+		// the provenance waits for the version to be published, as after eve pack
+		if err := restoreReleaseFiles(a.Files, unreleased); err != nil {
+			return err
+		}
+		fmt.Printf("Loaded version %s, publish it with eve publish --version %s\n", version, version)
+		return nil
+	}
+
+	if !flags.Force {
+		if err := checkVersionUnused(ctx, services, version); err != nil {
+			return err
+		}
+	}
+	return withHooks(ctx, stagePublish, func() error {
+		client := registry.New(registry.Options{})
+		var results []*publishResult
+		for _, svc := range services {
+			svc := svc
+			ref := svc.Image + ":" + version
+			commit := archivedCommit(a.Files, svc)
+			err := runPhase("Publishing "+svc.Name, "publish-"+svc.Name, func(w io.Writer) (string, error) {
+				fmt.Fprintf(w, "Pushing %s\n", ref)
+				if err := pushWithProgress(ctx, client, w, images[svc.Name].Image, ref); err != nil {
+					res := &publishResult{Service: svc, Repository: svc.Image, Err: err}
+					results = append(results, res)
+					return "", errors.Wrap(err, "failed to push image: "+svc.Image)
+				}
+				res := distributeImage(ctx, w, svc, ref, publishTags(ctx, version, commit))
+				results = append(results, res...)
+				if res[0].Err != nil {
+					return "", res[0].Err
+				}
+				return "Publishing Complete. Image ready " + ref, nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to publish service %s", svc.Name)
+			}
+		}
+		printPublishSummary(results)
+
+		if err := writevar("VERSION", version); err != nil {
+			return errors.Wrap(err, "failed to write VERSION variable")
+		}
+		if err := restoreReleaseFiles(a.Files, version); err != nil {
+			return err
+		}
+		for _, res := range results {
+			if res.Mirror {
+				continue
+			}
+			if err := recordDigest(version, res.Service, res.Digest); err != nil {
+				return errors.Wrapf(err, "failed to record the digest of service %s", res.Service.Name)
+			}
+		}
+		return publishError(results)
+	})
+}
+
+// restoreReleaseFiles writes the release history of an archive to the release directory of the version
+func restoreReleaseFiles(files map[string][]byte, version string) error {
+	dir := releaseDir(version)
+	for name, b := range files {
+		if !strings.HasPrefix(name, archiveReleaseDir+"/") {
+			continue
+		}
+		p := path.Join(dir, strings.TrimPrefix(name, archiveReleaseDir+"/"))
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, b, 0644); err != nil {
+			return errors.Wrap(err, "failed to write the release history")
+		}
+	}
+	return nil
+}
+
+// archivedCommit returns the commit of the image of the service in the provenance of an archive
+func archivedCommit(files map[string][]byte, svc *Service) string {
+	var p Provenance
+	b, ok := files[path.Join(archiveReleaseDir, svc.Name+".json")]
+	if !ok || json.Unmarshal(b, &p) != nil {
+		return ""
+	}
+	return p.GitCommit
+}
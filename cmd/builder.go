@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ovrclk/eve/build"
+	"github.com/ovrclk/eve/logger"
+)
+
+// BuilderFlags contains the flags for the builder commands
+type BuilderFlags struct {
+	NoPin bool
+}
+
+// NewBuilder creates a new command to manage the buildpacks builder
+func NewBuilder(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "builder",
+		Short: "Manage the buildpacks builder used to pack your project",
+	}
+	cmd.AddCommand(
+		NewBuilderList(ctx, cancel),
+		NewBuilderSuggest(ctx, cancel),
+		NewBuilderSet(ctx, cancel),
+	)
+	return cmd
+}
+
+func NewBuilderList(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the known builders",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			current, _ := readvar("BUILDER")
+			tab := uitable.New().AddRow("", "BUILDER", "LANGUAGES", "DESCRIPTION")
+			for _, b := range build.KnownBuilders {
+				mark := ""
+				if b.Image == current {
+					mark = "*"
+				}
+				tab.AddRow(mark, b.Image, strings.Join(b.Languages, ","), b.Description)
+			}
+			fmt.Println(tab.String())
+			if current != "" {
+				fmt.Println()
+				printBuilder()
+			}
+			return nil
+		},
+	}
+}
+
+func NewBuilderSuggest(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "suggest",
+		Short: "Suggest builders based on the files of the project",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := path.Join(globalFlags.Path, ".")
+			langs := build.DetectLanguages(dir)
+			if build.Detect(build.Options{Context: dir}) == build.Dockerfile {
+				fmt.Println("The project has a Dockerfile, it is built with the dockerfile backend unless --backend buildpacks is given")
+			}
+			if len(langs) == 0 {
+				fmt.Println("No language detected, use 'eve builder list' to see the known builders")
+				return nil
+			}
+			fmt.Println("Detected languages:", strings.Join(langs, ", "))
+			tab := uitable.New().AddRow("BUILDER", "DESCRIPTION")
+			for _, b := range build.KnownBuilders {
+				if b.Supports(langs) {
+					tab.AddRow(b.Image, b.Description)
+				}
+			}
+			fmt.Println(tab.String())
+			return nil
+		},
+	}
+}
+
+func NewBuilderSet(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &BuilderFlags{}
+	cmd := &cobra.Command{
+		Use:   "set <builder>",
+		Short: "Set the builder and pin its digest, run it again to upgrade the pinned digest",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setBuilder(ctx, args[0], !flags.NoPin); err != nil {
+				return err
+			}
+			printBuilder()
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&flags.NoPin, "no-pin", false, "Do not pin the digest of the builder, the latest image of the builder is used for every build")
+	return cmd
+}
+
+// setBuilder writes the builder to the state directory. When pin is true, the builder is pulled
+// and its digest is written to BUILDER_DIGEST so that builds are reproducible.
+func setBuilder(ctx context.Context, builder string, pin bool) error {
+	if err := writevar("BUILDER", builder); err != nil {
+		return err
+	}
+	if !pin {
+		// an empty digest also overrides the digest pinned for all the environments
+		return writevar("BUILDER_DIGEST", "")
+	}
+	digest, err := resolveBuilderDigest(ctx, builder)
+	if err != nil {
+		return err
+	}
+	return writevar("BUILDER_DIGEST", digest)
+}
+
+// resolveBuilderDigest pulls the builder and returns its repository digest reference
+func resolveBuilderDigest(ctx context.Context, builder string) (string, error) {
+	logger.Debug("resolveBuilderDigest: ", builder)
+	if _, err := commandOutput(ctx, "docker", "pull", "--quiet", builder); err != nil {
+		return "", errors.Wrapf(err, "failed to pull builder %s", builder)
+	}
+	digest, err := commandOutput(ctx, "docker", "image", "inspect", "--format", "{{index .RepoDigests 0}}", builder)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve the digest of builder %s", builder)
+	}
+	return digest, nil
+}
+
+func printBuilder() {
+	builder, _ := readvar("BUILDER")
+	digest, _ := readvar("BUILDER_DIGEST")
+	if digest == "" {
+		digest = "not pinned"
+	}
+	tab := uitable.New()
+	tab.AddRow("BUILDER", builder)
+	tab.AddRow("DIGEST", digest)
+	fmt.Println(tab.String())
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// defaultService is the SDL service of projects that do not declare services in .eve.yaml
+const defaultService = "web"
+
+// Service is the build configuration of a service declared in .eve.yaml, for example:
+//
+//	services:
+//	  api:
+//	    context: api
+//	    builder: heroku/buildpacks:20
+//	    image: ovrclk/api
+//	    env_files:
+//	      - api/.env
+//	  web:
+//	    context: web
+//	    image: ovrclk/web
+//	    backend: dockerfile
+//	    target: production
+//	    build_args:
+//	      NODE_VERSION: "18"
+//	    processes: true
+//
+// Projects that do not declare services enable processes with a top-level processes key.
+type Service struct {
+	// Name is the name of the matching SDL service
+	Name string `mapstructure:"-"`
+	// Context is the build context relative to the project path
+	Context  string   `mapstructure:"context"`
+	Builder  string   `mapstructure:"builder"`
+	Image    string   `mapstructure:"image"`
+	EnvFiles []string `mapstructure:"env_files"`
+	// Backend is the build backend, one of auto, buildpacks or dockerfile
+	Backend    string            `mapstructure:"backend"`
+	Dockerfile string            `mapstructure:"dockerfile"`
+	Target     string            `mapstructure:"target"`
+	BuildArgs  map[string]string `mapstructure:"build_args"`
+	// Processes adds an SDL service for each process type of the Procfile or the buildpacks
+	Processes bool `mapstructure:"processes"`
+}
+
+// projectServices returns the services declared in .eve.yaml sorted by name. When the image is given
+// or no services are declared, it returns the single web service built from the project path
+// with the image, or the IMAGE variable when the image is empty.
+func projectServices(image string) ([]*Service, error) {
+	var declared map[string]*Service
+	if image == "" {
+		if err := viper.UnmarshalKey("services", &declared); err != nil {
+			return nil, errors.Wrap(err, "failed to read services from the config")
+		}
+	}
+
+	if len(declared) == 0 {
+		if image == "" {
+			var err error
+			if image, err = readvar("IMAGE"); err != nil {
+				return nil, errors.Wrap(err, "failed to read IMAGE variable")
+			}
+		}
+		return []*Service{{
+			Name:      defaultService,
+			Context:   path.Join(globalFlags.Path, "."),
+			Image:     image,
+			Processes: viper.GetBool("processes"),
+		}}, nil
+	}
+
+	services := make([]*Service, 0, len(declared))
+	for name, svc := range declared {
+		if svc == nil || svc.Image == "" {
+			return nil, errors.Errorf("service %s: image is required", name)
+		}
+		svc.Name = name
+		svc.Context = path.Join(globalFlags.Path, svc.Context)
+		for i, f := range svc.EnvFiles {
+			svc.EnvFiles[i] = path.Join(globalFlags.Path, f)
+		}
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, nil
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 
 	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/registry"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -21,12 +22,13 @@ type DeployFlags struct {
 
 	PackFlags *PackFlags
 	*PublishFlags
+	SDLFlags *SDLFlags
 }
 
 var deployFlags *DeployFlags
 
 func NewDeploy(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
-	deployFlags = &DeployFlags{PackFlags: &PackFlags{}, PublishFlags: &PublishFlags{}}
+	deployFlags = &DeployFlags{PackFlags: &PackFlags{}, PublishFlags: &PublishFlags{}, SDLFlags: &SDLFlags{}}
 	cmd := &cobra.Command{
 		Use:   "deploy",
 		Short: "Deploy your application",
@@ -40,37 +42,30 @@ func NewDeploy(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			// publishing from the build skips the separate publish step
+			publishedByPack := !deployFlags.NoPack && !deployFlags.NoPublish && deployFlags.PackFlags.Publish
+			if deployFlags.NoPublish {
+				deployFlags.PackFlags.Publish = false
+			}
+			if publishedByPack {
+				deployFlags.PackFlags.Version = deployFlags.PublishFlags.Version
+				deployFlags.PackFlags.Force = deployFlags.PublishFlags.Force
+			}
+
 			if !deployFlags.NoPack {
 				if err := runPack(ctx, cancel, deployFlags.Image, deployFlags.PackFlags); err != nil {
 					return err
 				}
 			}
 
-			if !deployFlags.NoPublish {
+			if !deployFlags.NoPublish && !publishedByPack {
 				if err := runPublish(ctx, cancel, deployFlags.Image, deployFlags.PublishFlags); err != nil {
 					return err
 				}
 			}
 
 			if !deployFlags.NoUpdate {
-				//sdlSource := path.Join(globalFlags.Path, "sdl.yml")
-				version, err := readvar("VERSION")
-				if err != nil {
-					return err
-				}
-				sdlSource := path.Join(globalFlags.Path, "sdl.yml")
-				if err := runSDL(ctx, cancel, sdlSource, &SDLFlags{}); err != nil {
-					return err
-				}
-				sdltarget := path.Join(globalFlags.Path, globalFlags.StateDirName, "cache", "sdl."+version+".yml")
-
-				if err = runUpdateDeployment(ctx, cancel, dseq, sdltarget); err != nil {
-					return err
-				}
-
-				if err = runProviderSendManifest(ctx, cancel, provider, dseq, sdltarget); err != nil {
-					return err
-				}
+				return runDeployUpdate(ctx, cancel, dseq, provider, deployFlags.SDLFlags)
 			}
 
 			return nil
@@ -86,9 +81,71 @@ func NewDeploy(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 
 	bindPackFlags(deployFlags.PackFlags, cmd)
 	bindPublishFlags(deployFlags.PublishFlags, cmd)
+	bindSDLFlags(deployFlags.SDLFlags, cmd)
 	return cmd
 }
 
+// runDeployUpdate renders the SDL of the current version and updates the deployment and the manifest
+func runDeployUpdate(ctx context.Context, cancel context.CancelFunc, dseq, provider string, sdlFlags *SDLFlags) error {
+	version, err := readvar("VERSION")
+	if err != nil {
+		return err
+	}
+	if err := verifyDigests(ctx, version); err != nil {
+		return err
+	}
+	if protectedEnvironment() {
+		if err := verifySignatures(ctx, version, false); err != nil {
+			return errors.Wrap(err, "refusing to deploy to a protected environment")
+		}
+		// the signatures are verified for the recorded digests, deploy exactly those images
+		pinned := *sdlFlags
+		pinned.PinDigest = true
+		sdlFlags = &pinned
+	}
+	sdlSource := path.Join(globalFlags.Path, "sdl.yml")
+	if err := runSDL(ctx, cancel, sdlSource, sdlFlags); err != nil {
+		return err
+	}
+	sdltarget := path.Join(cacheDir(), "sdl."+version+".yml")
+
+	if err = runUpdateDeployment(ctx, cancel, dseq, sdltarget); err != nil {
+		return err
+	}
+
+	return runProviderSendManifest(ctx, cancel, provider, dseq, sdltarget)
+}
+
+// verifyDigests returns an error when the digest behind the version tag of a service differs from the
+// digest recorded when the version was published, as the tag was moved or overwritten since
+func verifyDigests(ctx context.Context, version string) error {
+	digests, err := publishedDigests(version)
+	if err != nil {
+		return err
+	}
+	services, err := projectServices("")
+	if err != nil {
+		return err
+	}
+	client := registry.New(registry.Options{})
+	for _, svc := range services {
+		published, ok := digests[svc.Name]
+		if !ok {
+			logger.Debugf("verifyDigests: no digest recorded for service %s at version %s", svc.Name, version)
+			continue
+		}
+		image := svc.Image + ":" + version
+		current, err := client.Digest(ctx, image)
+		if err != nil {
+			return errors.Wrapf(err, "failed to verify the digest of %s", image)
+		}
+		if current != published {
+			return errors.Errorf("refusing to deploy, %s changed since it was published: published %s, now %s", image, published, current)
+		}
+	}
+	return nil
+}
+
 func NewDeployCreateCMD(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 	deployCreateCmd := &cobra.Command{
 		Use:   "create",
@@ -111,7 +168,17 @@ func NewSendManifestCMD(ctx context.Context, cancel context.CancelFunc) *cobra.C
 	updateManifestCmd := &cobra.Command{
 		Use:   "update-manifest",
 		Short: "Update the manifest of your application",
+		Long: `Update the manifest of your application.
+
+The manifest is sent as is, the digests and the signatures of the images are not verified, so the
+command is refused in the protected environments of signing.protected_environments. Use eve deploy
+--no-pack --no-publish there.`,
 		Run: func(cmd *cobra.Command, args []string) {
+			if err := checkUnverifiedDeploy(); err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+
 			dseq, err := readvar("DSEQ")
 			if err != nil {
 				fmt.Println("error: ", err)
@@ -137,7 +204,17 @@ func NewUpdateDeploymentCMD(ctx context.Context, cancel context.CancelFunc) *cob
 	updateDeploymentCmd := &cobra.Command{
 		Use:   "update-deployment",
 		Short: "Update the deployment of your application",
+		Long: `Update the deployment of your application.
+
+The deployment is updated as is, the digests and the signatures of the images are not verified, so
+the command is refused in the protected environments of signing.protected_environments. Use eve deploy
+--no-pack --no-publish there.`,
 		Run: func(cmd *cobra.Command, args []string) {
+			if err := checkUnverifiedDeploy(); err != nil {
+				fmt.Println("error: ", err)
+				return
+			}
+
 			dseq, err := readvar("DSEQ")
 			if err != nil {
 				fmt.Println("error: ", err)
@@ -152,28 +229,42 @@ func NewUpdateDeploymentCMD(ctx context.Context, cancel context.CancelFunc) *cob
 	}
 	return updateDeploymentCmd
 }
-func runUpdateDeployment(ctx context.Context, cancel context.CancelFunc, dseq string, sdlPath string) error {
-	c := []string{"tx", "deployment", "update", "--dseq", dseq, "--from", "deploy", "-y", sdlPath}
-	logger.Debug("runUpdateDeployment: ", c)
-	cmd := exec.CommandContext(ctx, "akash", c...)
-	out, err := cmd.CombinedOutput()
-	fmt.Println(string(out))
-	if err != nil {
-		logger.Error("runUpdate Deploy error: ", err)
-		return err
+
+// checkUnverifiedDeploy returns an error in a protected environment, for the commands that update the
+// deployment without verifying the images
+func checkUnverifiedDeploy() error {
+	if protectedEnvironment() {
+		return errors.New("refusing to update a protected environment without verifying the signatures, use eve deploy --no-pack --no-publish")
 	}
 	return nil
 }
 
+func runUpdateDeployment(ctx context.Context, cancel context.CancelFunc, dseq string, sdlPath string) error {
+	return withHooks(ctx, stageUpdate, func() error {
+		c := []string{"tx", "deployment", "update", "--dseq", dseq, "--from", "deploy", "-y", sdlPath}
+		logger.Debug("runUpdateDeployment: ", c)
+		cmd := exec.CommandContext(ctx, "akash", c...)
+		out, err := cmd.CombinedOutput()
+		fmt.Println(string(out))
+		if err != nil {
+			logger.Error("runUpdate Deploy error: ", err)
+			return err
+		}
+		return nil
+	})
+}
+
 func runProviderSendManifest(ctx context.Context, cancel context.CancelFunc, provider, dseq, sdlPath string) error {
-	c := []string{"provider", "send-manifest", "--provider", provider, "--dseq", dseq, "--from", "deploy", sdlPath}
-	logger.Debug("runProviderSendManifest", c)
-	cmd := exec.CommandContext(ctx, "akash", c...)
-	out, err := cmd.CombinedOutput()
-	fmt.Println(string(out))
-	if err != nil {
-		logger.Error("runProviderSendManifest error: ", err)
-		return errors.Wrapf(err, "Unable to upload manifest to provider %s, for dseq %s", provider, dseq)
-	}
-	return nil
+	return withHooks(ctx, stageManifest, func() error {
+		c := []string{"provider", "send-manifest", "--provider", provider, "--dseq", dseq, "--from", "deploy", sdlPath}
+		logger.Debug("runProviderSendManifest", c)
+		cmd := exec.CommandContext(ctx, "akash", c...)
+		out, err := cmd.CombinedOutput()
+		fmt.Println(string(out))
+		if err != nil {
+			logger.Error("runProviderSendManifest error: ", err)
+			return errors.Wrapf(err, "Unable to upload manifest to provider %s, for dseq %s", provider, dseq)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/ovrclk/eve/logger"
+)
+
+// Stages of the pipeline that hooks can run before and after
+const (
+	stagePack     = "pack"
+	stagePublish  = "publish"
+	stageSDL      = "sdl"
+	stageUpdate   = "update"
+	stageManifest = "manifest"
+	stagePromote  = "promote"
+)
+
+// hookVars are the state variables exposed to the hooks as environment variables
+var hookVars = []string{"DSEQ", "VERSION", "IMAGE", "PROVIDER"}
+
+// withHooks runs the hooks declared in .eve.yaml before and after the stage, for example:
+//
+//	hooks:
+//	  before_pack:
+//	    - go test ./...
+//	  after_publish:
+//	    - ./scripts/migrate.sh
+//
+// Each hook is run with sh -c from the project path. The first hook that fails aborts the stage.
+func withHooks(ctx context.Context, stage string, fn func() error) error {
+	if err := runHooks(ctx, "before_"+stage); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return runHooks(ctx, "after_"+stage)
+}
+
+func runHooks(ctx context.Context, name string) error {
+	hooks := viper.GetStringSlice("hooks." + name)
+	if len(hooks) == 0 {
+		return nil
+	}
+	env := hookEnv(name)
+	for i, hook := range hooks {
+		logger.Debugf("runHooks: %s[%d]: %s", name, i, hook)
+		hook := hook
+		err := runPhase("Running hook "+name, "hook-"+name, func(w io.Writer) (string, error) {
+			fmt.Fprintln(w, "$ "+hook)
+			cmd := exec.CommandContext(ctx, "sh", "-c", hook)
+			cmd.Dir = path.Join(globalFlags.Path, ".")
+			cmd.Env = env
+			cmd.Stdout = w
+			cmd.Stderr = w
+			if err := cmd.Run(); err != nil {
+				return "", err
+			}
+			return "Hook " + name + " complete", nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "aborting, %s hook %q failed", name, hook)
+		}
+	}
+	return nil
+}
+
+// hookEnv returns the environment of the hooks with the state variables that are set
+func hookEnv(name string) []string {
+	env := append(os.Environ(), "EVE_HOOK="+name, "EVE_ENVIRONMENT="+globalFlags.Environment)
+	for _, v := range hookVars {
+		if val, err := readvar(v); err == nil {
+			env = append(env, v+"="+val)
+		}
+	}
+	return env
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ovrclk/eve/compose"
+	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/util/fsutil"
+)
+
+// defaultComposeFiles are the compose files looked up in the project when none is given
+var defaultComposeFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// ImportFlags contains the flags for the import commands
+type ImportFlags struct {
+	Output string
+	Force  bool
+}
+
+// NewImport creates a new command that imports other deployment formats
+func NewImport(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import deployment files from other tools",
+	}
+	cmd.AddCommand(NewImportCompose(ctx, cancel))
+	return cmd
+}
+
+func NewImportCompose(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &ImportFlags{}
+	cmd := &cobra.Command{
+		Use:   "compose [file]",
+		Short: "Translate a docker-compose file into an SDL",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			source := ""
+			if len(args) > 0 {
+				source = args[0]
+			}
+			return runImportCompose(ctx, cancel, source, flags)
+		},
+	}
+	cmd.Flags().StringVarP(&flags.Output, "output", "o", "sdl.yml", "Path to write the SDL to relative to the project path, '-' for stdout")
+	cmd.Flags().BoolVarP(&flags.Force, "force", "f", false, "Overwrite the SDL if it exists")
+	return cmd
+}
+
+func runImportCompose(ctx context.Context, cancel context.CancelFunc, source string, flags *ImportFlags) error {
+	if source == "" {
+		for _, name := range defaultComposeFiles {
+			if fsutil.FileExists(path.Join(globalFlags.Path, name)) {
+				source = name
+				break
+			}
+		}
+		if source == "" {
+			return errors.New("no compose file found, pass the path to the compose file")
+		}
+	}
+	p := path.Join(globalFlags.Path, source)
+	logger.Debug("runImportCompose: ", p)
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", p)
+	}
+	res, err := compose.Convert(b, filepath.Dir(p))
+	if err != nil {
+		return err
+	}
+	for _, w := range res.Warnings {
+		logger.Warn(w)
+	}
+
+	out, err := res.SDL.Marshal()
+	if err != nil {
+		return err
+	}
+	if flags.Output == "-" {
+		fmt.Print(string(out))
+		return nil
+	}
+
+	target := path.Join(globalFlags.Path, flags.Output)
+	if fsutil.FileExists(target) && !flags.Force {
+		return errors.Errorf("%s already exists, use --force to overwrite it", target)
+	}
+	if err := os.WriteFile(target, out, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s", target)
+	}
+	fmt.Printf("Imported %s into %s (%d services, %d warnings)\n", source, target, len(res.SDL.Services), len(res.Warnings))
+	return nil
+}
@@ -1,18 +1,22 @@
 package cmd
 
 import (
-	"bufio"
 	"context"
 	"fmt"
+	"io"
 
 	//"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/ovrclk/eve/build"
 	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/registry"
+	"github.com/ovrclk/eve/util/envutil"
+	"github.com/ovrclk/eve/util/fsutil"
+	"github.com/ovrclk/eve/util/gitutil"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -21,9 +25,29 @@ var DefaultBuilder = "heroku/buildpacks:20"
 
 // PackFlags contains the flags for the pack command
 type PackFlags struct {
-	Env      []string // Build-time environment variable, in the form 'VAR=VALUE' or 'VAR'.
-	EnvFiles []string // Build-time environment variables file
-	Builder  string   // Builder to use for building the image
+	Env        []string // Build-time environment variable, in the form 'VAR=VALUE' or 'VAR'.
+	EnvFiles   []string // Build-time environment variables file
+	Builder    string   // Builder to use for building the image
+	Backend    string   // Build backend, one of auto, buildpacks or dockerfile
+	Dockerfile string   // Path to the Dockerfile relative to the build context
+	Target     string   // Target stage of a Dockerfile build
+	BuildArgs  []string // Build arguments of a Dockerfile build, in the form 'VAR=VALUE' or 'VAR'.
+
+	ClearCache    bool   // Start the build from a clean cache
+	CacheImage    string // Image used as a shared build cache
+	Publish       bool   // Push the image to the registry as part of the build
+	PreviousImage string // Image to reuse layers from, defaults to the last published version
+	Version       string // Version tag of the published image
+	Force         bool   // Overwrite a version that was already published
+
+	Git string // Repository to build from instead of the project path, a URL or a local path
+	Ref string // Commit SHA, tag or branch of the repository to build
+
+	// commit and source are the SHA and the directory of the commit checked out from the repository
+	commit string
+	source string
+	// builders are the builders suggested for the buildpacks services without a builder
+	builders map[string]string
 }
 
 // NewPackCommand creates a new pack command
@@ -31,7 +55,7 @@ func NewPack(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 	packFlags := &PackFlags{}
 	cmd := &cobra.Command{
 		Use:   "pack",
-		Short: "Pack your project into a container using buildpacks",
+		Short: "Pack your project into a container using buildpacks or a Dockerfile",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			image := ""
 			if len(args) > 0 {
@@ -45,6 +69,8 @@ func NewPack(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 		},
 	}
 	bindPackFlags(packFlags, cmd)
+	cmd.Flags().StringVarP(&packFlags.Version, "version", "v", "", "Version of the image when publishing, it defaults to the versioning strategy of .eve.yaml")
+	cmd.Flags().BoolVar(&packFlags.Force, "force", false, "Overwrite the version when publishing if it was already published")
 	return cmd
 }
 
@@ -52,74 +78,310 @@ func bindPackFlags(flags *PackFlags, cmd *cobra.Command) {
 	cmd.Flags().StringArrayVarP(&flags.Env, "env", "e", []string{}, "Build-time environment variable, in the form 'VAR=VALUE' or 'VAR'.\nWhen using latter value-less form, value will be taken from current\n  environment at the time this command is executed.\nThis flag may be specified multiple times and will override\n  individual values defined by --env-file."+stringArrayHelp("env")+"\nNOTE: These are NOT available at image runtime.")
 	cmd.Flags().StringArrayVar(&flags.EnvFiles, "env-file", []string{}, "Build-time environment variables file\nOne variable per line, of the form 'VAR=VALUE' or 'VAR'\nWhen using latter value-less form, value will be taken from current\n  environment at the time this command is executed\nNOTE: These are NOT available at image runtime.\"")
 	cmd.Flags().StringVar(&flags.Builder, "builder", "", "Builder to use for building the image")
+	cmd.Flags().StringVar(&flags.Backend, "backend", "", "Build backend, one of auto, buildpacks or dockerfile\nauto uses dockerfile when the build context has a Dockerfile (default \"auto\")")
+	cmd.Flags().StringVar(&flags.Dockerfile, "dockerfile", "", "Path to the Dockerfile relative to the build context")
+	cmd.Flags().StringVar(&flags.Target, "target", "", "Target stage of a Dockerfile build")
+	cmd.Flags().BoolVar(&flags.ClearCache, "clear-cache", false, "Start the build from a clean cache")
+	cmd.Flags().StringVar(&flags.CacheImage, "cache-image", "", "Image to use as a shared build cache, requires --publish for buildpacks")
+	cmd.Flags().BoolVar(&flags.Publish, "publish", false, "Push the image to the registry as part of the build, skipping the separate publish step")
+	cmd.Flags().StringVar(&flags.PreviousImage, "previous-image", "", "Image to reuse layers from, it defaults to the last published version")
+	cmd.Flags().StringVar(&flags.Git, "git", "", "Build from a git repository, a URL or a local path, instead of the working directory")
+	cmd.Flags().StringVar(&flags.Ref, "ref", "", "Commit SHA, tag or branch to build with --git, it defaults to the default branch")
+	cmd.Flags().StringArrayVar(&flags.BuildArgs, "build-arg", []string{}, "Build argument of a Dockerfile build, in the form 'VAR=VALUE' or 'VAR'"+stringArrayHelp("build-arg"))
 }
 
 func runPack(ctx context.Context, cancel context.CancelFunc, image string, packFlags *PackFlags) (err error) {
-	// Check if the image name is provided if not read it from IMAGE file state directory
-	if image == "" {
-		image, err = readvar("IMAGE")
-		if err != nil {
-			return errors.Wrap(err, "failed to read IMAGE variable")
-		}
+	// Check if the image name is provided if not read the services from the config or the IMAGE file state directory
+	services, err := projectServices(image)
+	if err != nil {
+		return err
 	}
 	// Check if env-file is specified and if so, parse it
 	if len(packFlags.EnvFiles) == 0 && varExists("ENV") { // if ENV is set, use it
-		envFile := path.Join(globalFlags.Path, globalFlags.StateDirName, "ENV") // path to the ENV file
+		envFile := varPath("ENV") // path to the ENV file
 		packFlags.EnvFiles = []string{envFile}
 	}
 
-	// check if the builder is provided if not read it from BUILDER file state directory
-	if packFlags.Builder == "" {
-		if varExists("BUILDER") {
-			packFlags.Builder, _ = readvar("BUILDER")
-		} else {
-			// if BUILDER is not set, use the default one
-			packFlags.Builder = DefaultBuilder
-			// write the default builder to the state directory
-			writevar("BUILDER", packFlags.Builder)
+	// check the ref out into a temporary workspace and build the services from there
+	if packFlags.Git != "" {
+		workspace, err := os.MkdirTemp("", "eve-git-")
+		if err != nil {
+			return errors.Wrap(err, "failed to create the git workspace")
+		}
+		defer os.RemoveAll(workspace)
+		if services, err = checkoutServices(ctx, services, packFlags, workspace); err != nil {
+			return err
+		}
+	}
+	// the commit is used as the default version, clear it for builds from the working directory
+	if packFlags.Git != "" || varExists("BUILD_COMMIT") {
+		if err := writevar("BUILD_COMMIT", packFlags.commit); err != nil {
+			return err
+		}
+	}
+
+	// pack keeps the cache image in the registry, it cannot write it from a daemon build
+	if packFlags.CacheImage != "" && !packFlags.Publish {
+		for _, svc := range services {
+			backend, err := serviceBackend(svc, packFlags)
+			if err != nil {
+				return err
+			}
+			if backend == build.Buildpacks {
+				return errors.Errorf("--cache-image requires --publish for buildpacks builds, service %s builds with buildpacks", svc.Name)
+			}
+		}
+	}
+	if err := suggestBuilders(ctx, services, packFlags); err != nil {
+		return err
+	}
+
+	// read the last published version before it is replaced
+	lastVersion, _ := readvar("VERSION")
+	if packFlags.Publish {
+		if packFlags.Version, err = resolveVersion(ctx, packFlags.Version, firstNonEmpty(packFlags.source, globalFlags.Path)); err != nil {
+			return err
+		}
+		if !packFlags.Force {
+			if err := checkVersionUnused(ctx, services, packFlags.Version); err != nil {
+				return err
+			}
+		}
+	}
+
+	pack := func() error {
+		for _, svc := range services {
+			if err := packService(ctx, svc, packFlags, lastVersion); err != nil {
+				return errors.Wrapf(err, "failed to pack service %s", svc.Name)
+			}
+		}
+		if !packFlags.Publish {
+			return nil
+		}
+		// the builds push the version, add the other tags and the mirrors
+		var results []*publishResult
+		for _, svc := range services {
+			svc := svc
+			err := runPhase("Tagging "+svc.Name, "tag-"+svc.Name, func(w io.Writer) (string, error) {
+				res := distributeImage(ctx, w, svc, svc.Image+":"+packFlags.Version, publishTags(ctx, packFlags.Version, ""))
+				results = append(results, res...)
+				if res[0].Err != nil {
+					return "", res[0].Err
+				}
+				return "Tagging Complete. Image ready " + svc.Image + ":" + packFlags.Version, nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to tag service %s", svc.Name)
+			}
+		}
+		printPublishSummary(results)
+		if err := writevar("VERSION", packFlags.Version); err != nil {
+			return err
 		}
+		return publishError(results)
+	}
+
+	// the publish hooks run around the build when it publishes the images
+	if packFlags.Publish {
+		return withHooks(ctx, stagePack, func() error { return withHooks(ctx, stagePublish, pack) })
 	}
+	return withHooks(ctx, stagePack, pack)
+}
 
-	// construct the buildpack command
-	c := []string{"build", image, "--builder", packFlags.Builder}
-	env, err := parseEnv(packFlags.EnvFiles, packFlags.Env)
+// checkoutServices checks the ref of the repository out into the workspace and returns the services
+// with their build context in the workspace
+func checkoutServices(ctx context.Context, services []*Service, packFlags *PackFlags, workspace string) ([]*Service, error) {
+	source := packFlags.Git
+	// local repositories are relative to the project path
+	if fsutil.FileExists(path.Join(globalFlags.Path, source)) {
+		source = path.Join(globalFlags.Path, source)
+	}
+	dir := path.Join(workspace, "src")
+	commit, err := gitutil.Checkout(ctx, source, packFlags.Ref, dir)
 	if err != nil {
-		return errors.Wrap(err, "error parsing environment variables")
+		return nil, err
 	}
+	fmt.Printf("Building %s at %s (%s)\n", packFlags.Git, firstNonEmpty(packFlags.Ref, "HEAD"), gitutil.ShortSHA(commit))
+	packFlags.commit = commit
+	packFlags.source = dir
 
-	// add the environment variables to the command
-	for k, v := range env {
-		c = append(c, "--env", k+"="+v)
+	out := make([]*Service, 0, len(services))
+	for _, svc := range services {
+		rel, err := filepath.Rel(path.Join(globalFlags.Path, "."), svc.Context)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, errors.Errorf("service %s: build context %s is outside of the project", svc.Name, svc.Context)
+		}
+		s := *svc
+		s.Context = path.Join(dir, rel)
+		out = append(out, &s)
 	}
+	return out, nil
+}
 
-	logger.Debugf("running pack command: %s", strings.Join(c, " "))
+// packService builds the image of the service. The flags take precedence over the service config.
+// The layers of the last published version are reused unless a previous image is given, from the registry
+// when publishing and from the docker daemon otherwise.
+func packService(ctx context.Context, svc *Service, packFlags *PackFlags, lastVersion string) error {
+	env, err := parseEnv(append(append([]string{}, svc.EnvFiles...), packFlags.EnvFiles...), packFlags.Env)
+	if err != nil {
+		return errors.Wrap(err, "error parsing environment variables")
+	}
 
-	// run the command with the context
-	cmd := exec.CommandContext(ctx, "pack", c...)
-	r, _ := cmd.StdoutPipe()
-	err = cmd.Start()
+	opts := build.Options{
+		Image:      svc.Image,
+		Context:    svc.Context,
+		Env:        env,
+		Dockerfile: firstNonEmpty(packFlags.Dockerfile, svc.Dockerfile),
+		Target:     firstNonEmpty(packFlags.Target, svc.Target),
+		BuildArgs:  map[string]string{},
+		ClearCache: packFlags.ClearCache,
+		CacheImage: packFlags.CacheImage,
+		Publish:    packFlags.Publish,
+	}
+	if packFlags.commit != "" {
+		opts.Labels = map[string]string{
+			"org.opencontainers.image.revision": packFlags.commit,
+			"org.opencontainers.image.source":   packFlags.Git,
+		}
+	}
+	if packFlags.Publish {
+		opts.Tags = []string{svc.Image + ":" + packFlags.Version}
+	}
+	opts.PreviousImage = packFlags.PreviousImage
+	if opts.PreviousImage == "" && lastVersion != "" {
+		previous := svc.Image + ":" + lastVersion
+		opts.PreviousImage = previous
+		// daemon builds reuse the layers of the local image, which pack requires to exist
+		if !opts.Publish {
+			if _, err := registry.Local(ctx, previous); err != nil {
+				logger.Debugf("packService: not reusing the layers of %s: %v", previous, err)
+				opts.PreviousImage = ""
+			}
+		}
+	}
+	for k, v := range svc.BuildArgs {
+		opts.BuildArgs[k] = v
+	}
+	for _, arg := range packFlags.BuildArgs {
+		opts.BuildArgs = addEnvVar(opts.BuildArgs, arg)
+	}
+
+	backend, err := build.New(firstNonEmpty(packFlags.Backend, svc.Backend), opts)
 	if err != nil {
-		return errors.Wrap(err, "error starting pack")
+		return err
+	}
+	if backend.Name() == build.Buildpacks {
+		if opts.Builder, err = resolveBuilder(ctx, svc, packFlags); err != nil {
+			return err
+		}
 	}
+
+	logger.Debugf("packService: building %s with %s", svc.Image, backend.Name())
 	// TODO: add a timeout to the context
-	// scan the output and print it to the console
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		fmt.Println(scanner.Text())
+	return runPhase("Packaging "+svc.Name, "pack-"+svc.Name, func(w io.Writer) (string, error) {
+		res, err := backend.Build(ctx, opts, w)
+		if err != nil {
+			return "", err
+		}
+		version := ""
+		if opts.Publish {
+			version = packFlags.Version
+		}
+		if err := recordProvenance(ctx, svc, res, opts.Builder, version, opts.Publish); err != nil {
+			logger.Warnf("unable to record the provenance of %s: %v", res.Image, err)
+		}
+		// the digests pin the version to the pushed images
+		if opts.Publish {
+			digest, err := registry.New(registry.Options{}).Digest(ctx, svc.Image+":"+version)
+			if err != nil {
+				return "", err
+			}
+			if err := recordDigest(version, svc, digest); err != nil {
+				return "", errors.Wrap(err, "failed to record the digest")
+			}
+		}
+		return fmt.Sprintf("Packing Complete. Image ready %s (%s)", res.Image, res.Backend), nil
+	})
+}
+
+// resolveBuilder returns the buildpacks builder of the service. The builder flag takes precedence over
+// the builder of the service, which takes precedence over the pinned BUILDER_DIGEST and the BUILDER variable.
+// Without any of them, the builder suggested for the service is used.
+func resolveBuilder(ctx context.Context, svc *Service, packFlags *PackFlags) (string, error) {
+	if builder := firstNonEmpty(packFlags.Builder, svc.Builder, packFlags.builders[svc.Name]); builder != "" {
+		return builder, nil
+	}
+	if varExists("BUILDER_DIGEST") {
+		return readvar("BUILDER_DIGEST")
 	}
-	// wait for the command to finish
-	if err := cmd.Wait(); err != nil {
-		logger.Errorf("error: %v", err)
-		return errors.Wrap(err, "error waiting for pack")
+	return readvar("BUILDER")
+}
+
+// suggestBuilders suggests a builder for the buildpacks services without a builder when no BUILDER is
+// set. The builder is set and pinned when a single service needs one, otherwise each service uses its
+// own suggestion, as one pinned builder would build every service.
+func suggestBuilders(ctx context.Context, services []*Service, packFlags *PackFlags) error {
+	if packFlags.Builder != "" || varExists("BUILDER") {
+		return nil
+	}
+	contexts := map[string]string{}
+	for _, svc := range services {
+		if svc.Builder != "" {
+			continue
+		}
+		backend, err := serviceBackend(svc, packFlags)
+		if err != nil {
+			return err
+		}
+		if backend == build.Buildpacks {
+			contexts[svc.Name] = svc.Context
+		}
+	}
+	builders, pin := build.SuggestBuilders(contexts, DefaultBuilder)
+	if !pin {
+		for _, svc := range services {
+			if builder, ok := builders[svc.Name]; ok {
+				logger.Warnf("service %s: no builder set, using %s, set builder for the service in .eve.yaml to change it", svc.Name, builder)
+			}
+		}
+		packFlags.builders = builders
+		return nil
+	}
+	for _, builder := range builders {
+		logger.Warnf("no builder set, using %s, run 'eve builder suggest' and 'eve builder set' to change it", builder)
+		if err := setBuilder(ctx, builder, true); err != nil {
+			logger.Warnf("unable to pin the builder: %v", err)
+			packFlags.builders = builders
+		}
 	}
 	return nil
 }
 
+// serviceBackend returns the name of the build backend of the service
+func serviceBackend(svc *Service, packFlags *PackFlags) (string, error) {
+	opts := build.Options{Context: svc.Context, Dockerfile: firstNonEmpty(packFlags.Dockerfile, svc.Dockerfile)}
+	backend, err := build.New(firstNonEmpty(packFlags.Backend, svc.Backend), opts)
+	if err != nil {
+		return "", err
+	}
+	return backend.Name(), nil
+}
+
+// firstNonEmpty returns the first non empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // parseEnv parses the environment variables from the env-file and env flags
 func parseEnv(envFiles []string, envVars []string) (map[string]string, error) {
 	env := map[string]string{}
 	for _, envFile := range envFiles {
-		envFileVars, err := parseEnvFile(envFile)
+		envFileVars, err := envutil.ParseFile(envFile)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to parse env file '%s'", envFile)
 		}
@@ -134,23 +396,6 @@ func parseEnv(envFiles []string, envVars []string) (map[string]string, error) {
 	return env, nil
 }
 
-// parseEnvFile parses the environment variables from the path to the filename
-func parseEnvFile(filename string) (map[string]string, error) {
-	out := make(map[string]string)
-	f, err := os.ReadFile(filepath.Clean(filename))
-	if err != nil {
-		return nil, errors.Wrapf(err, "open %s", filename)
-	}
-	for _, line := range strings.Split(string(f), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		out = addEnvVar(out, line)
-	}
-	return out, nil
-}
-
 // addEnvVar adds the environment variable to the map
 func addEnvVar(env map[string]string, item string) map[string]string {
 	arr := strings.SplitN(item, "=", 2)
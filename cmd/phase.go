@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/ui"
+)
+
+// runPhase runs the step under the phase heading. The combined output of the step is written
+// indented under the heading and to a log file under logs in the state directory. The step
+// returns the closing heading. When the step fails, the tail of its output is shown.
+func runPhase(heading, logName string, step func(w io.Writer) (string, error)) error {
+	logDir := path.Join(stateDir(), "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create log directory %s", logDir)
+	}
+	logPath := path.Join(logDir, logName+"-"+time.Now().Format("20060102T150405.000")+".log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create log file %s", logPath)
+	}
+	defer logFile.Close()
+	logger.Debug("runPhase: logging to ", logPath)
+
+	phase := ui.NewPhase(os.Stdout, heading)
+	done, err := step(io.MultiWriter(phase, logFile))
+	if err != nil {
+		phase.Flush()
+		tail := phase.Tail()
+		fmt.Fprintf(os.Stderr, "%s%s failed, last %d lines of the output:\n", ui.PhasePrefix, heading, len(tail))
+		for _, line := range tail {
+			fmt.Fprintln(os.Stderr, ui.PhaseIndent+line)
+		}
+		return errors.Wrapf(err, "%s failed, see the full log at %s", strings.ToLower(heading), logPath)
+	}
+	phase.Done(done)
+	return nil
+}
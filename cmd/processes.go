@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ovrclk/eve/build"
+	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/util/sdlutil"
+)
+
+const (
+	// webProcess is the process type that runs in the service itself and keeps its exposes
+	webProcess = "web"
+	// releaseProcess is the process type that runs once per release, which has no SDL equivalent
+	releaseProcess = "release"
+)
+
+// syncProcesses adds an SDL service for each process type of the services that enable processes.
+// The web process runs in the service itself, the other process types run in a copy of the service
+// named <service>-<type>, without exposes. The release process is skipped, a service would run it
+// again on each restart. It returns the names of the process services mapped to the name of their
+// service.
+func syncProcesses(doc *sdlutil.Document, services []*Service, version string) (map[string]string, error) {
+	processServices := map[string]string{}
+	for _, svc := range services {
+		if !svc.Processes {
+			continue
+		}
+		procs, launcher, err := serviceProcesses(svc, version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the processes of service %s", svc.Name)
+		}
+		if len(procs) == 0 {
+			logger.Warnf("service %s: no Procfile or buildpack processes found", svc.Name)
+			continue
+		}
+		for _, proc := range procs {
+			if proc.Type == releaseProcess {
+				logger.Warnf("service %s: skipping the release process, run it before deploying", svc.Name)
+				continue
+			}
+			name := svc.Name
+			if proc.Type != webProcess {
+				if name, err = proc.ServiceName(svc.Name); err != nil {
+					return nil, err
+				}
+				// a service of the SDL or of another process type must not be replaced
+				if _, err := doc.Service(name); err == nil {
+					return nil, errors.Errorf("process type %s of service %s: service %s already exists", proc.Type, svc.Name, name)
+				}
+				if err := doc.CloneService(svc.Name, name); err != nil {
+					return nil, err
+				}
+				if err := doc.DeleteKey(name, "expose"); err != nil {
+					return nil, err
+				}
+				processServices[name] = svc.Name
+			}
+			// images built with buildpacks run a process type through the launcher
+			command := []string{"/cnb/process/" + proc.Type}
+			if !launcher {
+				command = []string{"sh", "-c", proc.Command}
+			}
+			if err := doc.SetCommand(name, command, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return processServices, nil
+}
+
+// serviceProcesses returns the process types of the service from the provenance of the version, or
+// from the Procfile of the service. It reports whether the image runs the processes with the
+// buildpacks launcher.
+func serviceProcesses(svc *Service, version string) ([]build.Process, bool, error) {
+	provs, err := readProvenance(version)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, p := range provs {
+		if p.Service != svc.Name || len(p.Processes) == 0 {
+			continue
+		}
+		procs := make([]build.Process, 0, len(p.Processes))
+		for _, proc := range p.Processes {
+			procs = append(procs, build.Process{Type: proc.Type, Command: proc.Command})
+		}
+		return procs, true, nil
+	}
+
+	procs, err := build.ReadProcfile(svc.Context)
+	if err != nil {
+		return nil, false, err
+	}
+	backend := svc.Backend
+	if backend == "" || backend == build.Auto {
+		backend = build.Detect(build.Options{Context: svc.Context, Dockerfile: svc.Dockerfile})
+	}
+	return procs, backend == build.Buildpacks, nil
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/registry"
+	"github.com/ovrclk/eve/util/fsutil"
+)
+
+// defaultEnvironment names the state directory itself, used when no environment is selected
+const defaultEnvironment = "default"
+
+// PromoteFlags contains the flags for the promote command
+type PromoteFlags struct {
+	From    string
+	To      string
+	Version string
+}
+
+// NewPromote creates a new command that deploys the release of an environment to another environment
+func NewPromote(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &PromoteFlags{}
+	cmd := &cobra.Command{
+		Use:   "promote --from <environment> --to <environment>",
+		Short: "Deploy the images an environment runs to another environment without rebuilding",
+		Long: `Deploy the images an environment runs to another environment without rebuilding.
+
+The exact image digests of the version of the source environment, it defaults to the version it runs,
+are tagged with the publish tags of the target environment and copied to the mirrors. The SDL is then
+rendered with the config, secrets and registry credentials of the target environment, pinned to the
+digests, and the deployment of the target environment is updated. The promotion is recorded in the
+release history of the target environment. "default" names the state directory without environment.
+
+Promoting to a protected environment requires valid signatures of the images, read from the release
+history of the source environment and the registry, and checked before the target environment changes.`,
+		Example: "eve promote --from staging --to production",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPromote(ctx, cancel, flags)
+		},
+	}
+	cmd.Flags().StringVar(&flags.From, "from", "", "Environment to promote from")
+	cmd.Flags().StringVar(&flags.To, "to", "", "Environment to promote to")
+	cmd.Flags().StringVarP(&flags.Version, "version", "v", "", "Version to promote, it defaults to the version of the source environment")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+func runPromote(ctx context.Context, cancel context.CancelFunc, flags *PromoteFlags) error {
+	if flags.From == flags.To {
+		return errors.New("--from and --to must be different environments")
+	}
+	defer useEnvironment(globalFlags.Environment)
+	useEnvironment(flags.To)
+	protected := protectedEnvironment()
+
+	// read the release of the source environment
+	useEnvironment(flags.From)
+	version := flags.Version
+	if version == "" {
+		var err error
+		if version, err = readvar("VERSION"); err != nil {
+			return errors.Wrapf(err, "no version deployed in environment %s", flags.From)
+		}
+	}
+	services, err := projectServices("")
+	if err != nil {
+		return err
+	}
+	provs, err := readProvenance(version)
+	if err != nil {
+		return err
+	}
+	commits := map[string]string{}
+	for _, p := range provs {
+		commits[p.Service] = p.GitCommit
+	}
+	client := registry.New(registry.Options{})
+	digests := map[string]string{}
+	for _, svc := range services {
+		if digests[svc.Name], err = versionDigest(ctx, client, svc, version); err != nil {
+			return errors.Wrapf(err, "failed to resolve the digest of service %s at version %s", svc.Name, version)
+		}
+	}
+	// check the signatures recorded with the source release before the target environment changes
+	if protected {
+		if err := verifySignatures(ctx, version, false); err != nil {
+			return errors.Wrap(err, "refusing to promote to a protected environment")
+		}
+	}
+	src := releaseDir(version)
+
+	useEnvironment(flags.To)
+	dseq, err := readvar("DSEQ")
+	if err != nil {
+		return err
+	}
+	provider, err := readvar("PROVIDER")
+	if err != nil {
+		return err
+	}
+
+	return withHooks(ctx, stagePromote, func() error {
+		// the release history of the target holds the digests the SDL is pinned to
+		if fsutil.FileExists(src) {
+			if err := fsutil.CopyDir(src, releaseDir(version)); err != nil {
+				return errors.Wrap(err, "failed to copy the release history")
+			}
+		}
+		for _, svc := range services {
+			if err := recordPromotion(version, svc, digests[svc.Name], flags.From, time.Time{}); err != nil {
+				return err
+			}
+		}
+
+		var results []*publishResult
+		for _, svc := range services {
+			svc := svc
+			image := svc.Image + "@" + digests[svc.Name]
+			err := runPhase("Promoting "+svc.Name, "promote-"+svc.Name, func(w io.Writer) (string, error) {
+				fmt.Fprintf(w, "Promoting %s from %s to %s\n", image, flags.From, flags.To)
+				res := distributeImage(ctx, w, svc, image, publishTags(ctx, version, commits[svc.Name]))
+				results = append(results, res...)
+				if res[0].Err != nil {
+					return "", res[0].Err
+				}
+				return "Promotion Complete. Image ready " + svc.Image + ":" + version, nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to promote service %s", svc.Name)
+			}
+		}
+		printPublishSummary(results)
+		if err := publishError(results); err != nil {
+			return err
+		}
+
+		if err := deployPromotion(ctx, cancel, dseq, provider, version); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		for _, svc := range services {
+			if err := recordPromotion(version, svc, digests[svc.Name], flags.From, now); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Promoted version %s from %s to %s\n", version, flags.From, flags.To)
+		return nil
+	})
+}
+
+// deployPromotion updates the deployment of the current environment to the version, pinned to the
+// recorded digests. The previous version of the environment is restored when the update fails.
+func deployPromotion(ctx context.Context, cancel context.CancelFunc, dseq, provider, version string) error {
+	p := path.Join(stateDir(), "VERSION")
+	previous, err := os.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := writevar("VERSION", version); err != nil {
+		return errors.Wrap(err, "failed to write VERSION variable")
+	}
+	err = runDeployUpdate(ctx, cancel, dseq, provider, &SDLFlags{PinDigest: true})
+	if err == nil {
+		return nil
+	}
+	if previous == nil {
+		os.Remove(p)
+	} else if werr := writevar("VERSION", string(previous)); werr != nil {
+		logger.Errorf("failed to restore VERSION: %v", werr)
+	}
+	return err
+}
+
+// recordPromotion records the digest of the service in the release history of the current environment
+// and, when at is set, that the version was promoted from the environment at that time
+func recordPromotion(version string, svc *Service, digest, from string, at time.Time) error {
+	p := &Provenance{Service: svc.Name, Image: svc.Image}
+	file := path.Join(releaseDir(version), svc.Name+".json")
+	if err := readJSONFile(file, p); err != nil {
+		return err
+	}
+	p.Version = version
+	p.Digest = digest
+	if !at.IsZero() {
+		p.PromotedFrom = from
+		p.PromotedAt = at
+	}
+	if err := os.MkdirAll(releaseDir(version), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create release directory %s", releaseDir(version))
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0644)
+}
+
+// useEnvironment selects the environment, "default" selects the state directory itself
+func useEnvironment(name string) {
+	if name == defaultEnvironment {
+		name = ""
+	}
+	globalFlags.Environment = name
+}
@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ovrclk/eve/build"
+	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/util/fsutil"
+	"github.com/ovrclk/eve/util/gitutil"
+)
+
+// unreleased is the release directory of the images that are built but not yet published
+const unreleased = "_unreleased"
+
+// Provenance is the build metadata of the image of a service
+type Provenance struct {
+	Service string `json:"service"`
+	Image   string `json:"image"`
+	Version string `json:"version,omitempty"`
+	// Digest is the digest of the published image, resolved when the version is published
+	Digest        string          `json:"digest,omitempty"`
+	PublishedAt   time.Time       `json:"published_at,omitempty"`
+	Backend       string          `json:"backend"`
+	Builder       string          `json:"builder,omitempty"`
+	BuilderDigest string          `json:"builder_digest,omitempty"`
+	RunImage      string          `json:"run_image,omitempty"`
+	Buildpacks    []BuildpackInfo `json:"buildpacks,omitempty"`
+	Processes     []ProcessInfo   `json:"processes,omitempty"`
+	GitCommit     string          `json:"git_commit,omitempty"`
+	GitDirty      bool            `json:"git_dirty,omitempty"`
+	BuiltAt       time.Time       `json:"built_at"`
+	// PromotedFrom is the environment the version was promoted from, PromotedAt is when
+	PromotedFrom string    `json:"promoted_from,omitempty"`
+	PromotedAt   time.Time `json:"promoted_at,omitempty"`
+	// SBOM is the path to the bill of materials relative to the release directory
+	SBOM string `json:"sbom,omitempty"`
+}
+
+// BuildpackInfo is a buildpack that contributed to the image
+type BuildpackInfo struct {
+	ID       string `json:"id"`
+	Version  string `json:"version"`
+	Homepage string `json:"homepage,omitempty"`
+}
+
+// ProcessInfo is a process type defined by the buildpacks
+type ProcessInfo struct {
+	Type    string   `json:"type"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Default bool     `json:"default"`
+}
+
+// packInspectOutput is the output of pack inspect --output json
+type packInspectOutput struct {
+	Local  *packImageInfo `json:"local_info"`
+	Remote *packImageInfo `json:"remote_info"`
+}
+
+type packImageInfo struct {
+	Base struct {
+		TopLayer  string `json:"top_layer"`
+		Reference string `json:"reference"`
+	} `json:"base_image"`
+	Buildpacks []BuildpackInfo `json:"buildpacks"`
+	Processes  []ProcessInfo   `json:"processes"`
+}
+
+// NewInspect creates a new command that shows the provenance of a version
+func NewInspect(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect [version]",
+		Short: "Show the build provenance and bill of materials of a version, it defaults to the current version",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := versionArg(args)
+			if err != nil {
+				return err
+			}
+			return runInspect(ctx, cancel, version)
+		},
+	}
+}
+
+func runInspect(ctx context.Context, cancel context.CancelFunc, version string) error {
+	provs, err := readProvenance(version)
+	if err != nil {
+		return err
+	}
+	if len(provs) == 0 {
+		return errors.Errorf("no provenance recorded for version %s", version)
+	}
+	for _, p := range provs {
+		tab := uitable.New()
+		tab.AddRow("SERVICE", p.Service)
+		tab.AddRow("IMAGE", p.Image+":"+version)
+		if p.Digest != "" {
+			tab.AddRow("DIGEST", p.Digest)
+		}
+		tab.AddRow("BACKEND", p.Backend)
+		if p.Builder != "" {
+			tab.AddRow("BUILDER", p.Builder)
+			tab.AddRow("BUILDER_DIGEST", p.BuilderDigest)
+		}
+		if p.RunImage != "" {
+			tab.AddRow("RUN_IMAGE", p.RunImage)
+		}
+		commit := p.GitCommit
+		if p.GitDirty {
+			commit += " (dirty)"
+		}
+		tab.AddRow("GIT_COMMIT", commit)
+		if !p.BuiltAt.IsZero() {
+			tab.AddRow("BUILT_AT", p.BuiltAt.Format(time.RFC3339))
+		}
+		if !p.PublishedAt.IsZero() {
+			tab.AddRow("PUBLISHED_AT", p.PublishedAt.Format(time.RFC3339))
+		}
+		if p.PromotedFrom != "" {
+			tab.AddRow("PROMOTED_FROM", p.PromotedFrom)
+			tab.AddRow("PROMOTED_AT", p.PromotedAt.Format(time.RFC3339))
+		}
+		if p.SBOM != "" {
+			tab.AddRow("SBOM", path.Join(releaseDir(version), p.SBOM))
+		}
+		fmt.Println(tab.String())
+
+		if len(p.Buildpacks) > 0 {
+			bps := uitable.New().AddRow("", "BUILDPACK", "VERSION")
+			for _, bp := range p.Buildpacks {
+				bps.AddRow("", bp.ID, bp.Version)
+			}
+			fmt.Println(bps.String())
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// recordProvenance records the provenance of the image built for the service. When the version is
+// empty, it is recorded as unreleased until the image is published.
+func recordProvenance(ctx context.Context, svc *Service, res *build.Result, builder, version string, remote bool) error {
+	p := &Provenance{
+		Service: svc.Name,
+		Image:   svc.Image,
+		Version: version,
+		Backend: res.Backend,
+		BuiltAt: time.Now().UTC(),
+	}
+	p.GitCommit, p.GitDirty, _ = gitutil.Head(ctx, svc.Context)
+
+	if version == "" {
+		version = unreleased
+	}
+	dir := releaseDir(version)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create release directory %s", dir)
+	}
+
+	if res.Backend == build.Buildpacks {
+		p.Builder = builder
+		if out, err := commandOutput(ctx, "docker", "image", "inspect", "--format", "{{index .RepoDigests 0}}", builder); err == nil {
+			p.BuilderDigest = out
+		}
+
+		args := []string{"inspect", res.Image, "--output", "json"}
+		if out, err := commandOutput(ctx, "pack", args...); err != nil {
+			logger.Warnf("unable to inspect %s: %v", res.Image, err)
+		} else {
+			var inspect packInspectOutput
+			if err := json.Unmarshal([]byte(out), &inspect); err != nil {
+				logger.Warnf("unable to decode the inspection of %s: %v", res.Image, err)
+			}
+			info := inspect.Local
+			if remote || info == nil {
+				info = inspect.Remote
+			}
+			if info != nil {
+				p.RunImage = info.Base.Reference
+				p.Buildpacks = info.Buildpacks
+				p.Processes = info.Processes
+			}
+		}
+
+		// download the bill of materials, builders without SBOM support have none
+		sbom := path.Join("sbom", svc.Name)
+		os.RemoveAll(path.Join(dir, sbom))
+		args = []string{"sbom", "download", res.Image, "--output-dir", path.Join(dir, sbom)}
+		if remote {
+			args = append(args, "--remote")
+		}
+		if _, err := commandOutput(ctx, "pack", args...); err != nil {
+			logger.Warnf("unable to download the bill of materials of %s: %v", res.Image, err)
+		} else {
+			p.SBOM = sbom
+		}
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, svc.Name+".json"), b, 0644)
+}
+
+// releaseProvenance moves the unreleased provenance to the published version
+func releaseProvenance(version string) error {
+	src := releaseDir(unreleased)
+	if !fsutil.FileExists(src) {
+		return nil
+	}
+	dst := releaseDir(version)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create release directory %s", dst)
+	}
+	matches, err := filepath.Glob(path.Join(src, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		var p Provenance
+		if err := readJSONFile(m, &p); err != nil {
+			return err
+		}
+		p.Version = version
+		b, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path.Join(dst, filepath.Base(m)), b, 0644); err != nil {
+			return err
+		}
+		if p.SBOM != "" {
+			os.RemoveAll(path.Join(dst, p.SBOM))
+			if err := os.MkdirAll(path.Dir(path.Join(dst, p.SBOM)), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(path.Join(src, p.SBOM), path.Join(dst, p.SBOM)); err != nil {
+				return errors.Wrap(err, "failed to move the bill of materials")
+			}
+		}
+	}
+	return os.RemoveAll(src)
+}
+
+// recordDigest records the digest of the published image of the service in the provenance of the
+// version, images published without eve pack get a provenance with only their digest
+func recordDigest(version string, svc *Service, digest string) error {
+	p := &Provenance{Service: svc.Name, Image: svc.Image}
+	file := path.Join(releaseDir(version), svc.Name+".json")
+	if fsutil.FileExists(file) {
+		if err := readJSONFile(file, p); err != nil {
+			return err
+		}
+	}
+	p.Image = svc.Image
+	p.Version = version
+	p.Digest = digest
+	p.PublishedAt = time.Now().UTC()
+	if err := os.MkdirAll(releaseDir(version), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create release directory %s", releaseDir(version))
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0644)
+}
+
+// publishedDigests returns the digests of the published images of the version by service
+func publishedDigests(version string) (map[string]string, error) {
+	provs, err := readProvenance(version)
+	if err != nil {
+		return nil, err
+	}
+	digests := map[string]string{}
+	for _, p := range provs {
+		if p.Digest != "" {
+			digests[p.Service] = p.Digest
+		}
+	}
+	return digests, nil
+}
+
+// readProvenance reads the provenance of the services of the version
+func readProvenance(version string) ([]*Provenance, error) {
+	matches, err := filepath.Glob(path.Join(releaseDir(version), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	provs := make([]*Provenance, 0, len(matches))
+	for _, m := range matches {
+		p := &Provenance{}
+		if err := readJSONFile(m, p); err != nil {
+			return nil, err
+		}
+		provs = append(provs, p)
+	}
+	sort.Slice(provs, func(i, j int) bool { return provs[i].Service < provs[j].Service })
+	return provs, nil
+}
+
+// releasedVersions returns the versions in the release history
+func releasedVersions() ([]string, error) {
+	entries, err := os.ReadDir(path.Join(stateDir(), "releases"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var versions []string
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != unreleased {
+			versions = append(versions, e.Name())
+		}
+	}
+	return versions, nil
+}
+
+// releaseDir returns the directory of the release of the version
+func releaseDir(version string) string {
+	return path.Join(stateDir(), "releases", version)
+}
+
+// commandOutput runs the command and returns its trimmed output
+func commandOutput(ctx context.Context, name string, args ...string) (string, error) {
+	logger.Debugf("commandOutput: %s %s", name, strings.Join(args, " "))
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", errors.Errorf("%s: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/ovrclk/eve/registry"
+)
+
+// signatureTagPattern matches the tags of the cosign signatures and attestations of images
+var signatureTagPattern = regexp.MustCompile(`^sha256-[0-9a-f]{64}\.(sig|att|sbom)$`)
+
+// PruneFlags contains the flags for the publish prune command
+type PruneFlags struct {
+	Keep   int
+	DryRun bool
+}
+
+// NewPublishPrune creates a new command that deletes the version tags of old images from the registry
+func NewPublishPrune(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &PruneFlags{}
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete the version tags of old images from the registries",
+		Long: `Delete the version tags of old images from the repositories of the services and their mirrors.
+
+The versions deployed in any environment and the versions in the release history of any environment
+are never deleted. Of the other version tags of a repository, the tags of the most recent images are
+kept. Tags that move between images, latest, the environment names and the literal tags of publish.tags,
+are never deleted, and neither are the signature tags or the tags of an image that is also tagged with
+a kept tag. The release history is left untouched.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPublishPrune(ctx, cancel, flags)
+		},
+	}
+	cmd.Flags().IntVar(&flags.Keep, "keep", 10, "Number of the most recent images to keep in each repository")
+	cmd.Flags().BoolVar(&flags.DryRun, "dry-run", false, "Print the tags that would be deleted without deleting them")
+	return cmd
+}
+
+func runPublishPrune(ctx context.Context, cancel context.CancelFunc, flags *PruneFlags) error {
+	if flags.Keep < 0 {
+		return errors.New("--keep must not be negative")
+	}
+	protected, err := protectedVersions()
+	if err != nil {
+		return err
+	}
+	pinned, err := pinnedTags()
+	if err != nil {
+		return err
+	}
+	services, err := projectServices("")
+	if err != nil {
+		return err
+	}
+	client := registry.New(registry.Options{})
+	tab := uitable.New()
+	tab.MaxColWidth = 80
+	tab.Wrap = true
+	tab.AddRow("TAG", "REPOSITORY", "STATUS")
+	var failed, pruned bool
+	for _, svc := range services {
+		for _, repo := range append([]string{svc.Image}, publishMirrors(svc.Image)...) {
+			statuses, err := pruneRepository(ctx, client, repo, protected, pinned, flags.Keep, flags.DryRun)
+			if err != nil {
+				failed = true
+				tab.AddRow("*", repo, "failed: "+err.Error())
+				continue
+			}
+			for _, st := range statuses {
+				pruned = true
+				tab.AddRow(st.tag, repo, st.status)
+				if st.failed {
+					failed = true
+				}
+			}
+		}
+	}
+	if !pruned && !failed {
+		fmt.Println("Nothing to prune")
+		return nil
+	}
+	if flags.DryRun {
+		fmt.Println("Dry run, nothing was deleted")
+	}
+	fmt.Println(tab.String())
+	if failed {
+		return errors.New("failed to prune some tags")
+	}
+	return nil
+}
+
+// pruneStatus is the outcome of pruning a tag from a repository
+type pruneStatus struct {
+	tag    string
+	status string
+	failed bool
+}
+
+// pruneRepository deletes the version tags of the repository beyond the tags of the keep most recent
+// images. The protected versions and the pinned tags are never deleted, and neither are the tags of an
+// image that is also tagged with a kept tag, since deleting a tag may delete the image itself.
+func pruneRepository(ctx context.Context, client *registry.Client, repo string, protected map[string]string, pinned map[string]bool, keep int, dryRun bool) ([]pruneStatus, error) {
+	tags, err := client.Tags(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	// the digests of the tags that are kept whatever their age, and the candidates by digest
+	kept := map[string]string{}
+	candidates := map[string][]string{}
+	var digests []string
+	for _, tag := range tags {
+		digest, err := client.Digest(ctx, repo+":"+tag)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := protected[tag]; ok || pinned[tag] || signatureTagPattern.MatchString(tag) {
+			kept[digest] = tag
+			continue
+		}
+		if _, ok := candidates[digest]; !ok {
+			digests = append(digests, digest)
+		}
+		candidates[digest] = append(candidates[digest], tag)
+	}
+
+	// the most recent images first, by creation time and then by tag
+	created := map[string]time.Time{}
+	for _, digest := range digests {
+		created[digest] = imageCreated(ctx, client, repo+"@"+digest)
+		sort.Strings(candidates[digest])
+	}
+	sort.SliceStable(digests, func(i, j int) bool {
+		ti, tj := created[digests[i]], created[digests[j]]
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return candidates[digests[i]][0] > candidates[digests[j]][0]
+	})
+
+	var statuses []pruneStatus
+	for i, digest := range digests {
+		if i < keep {
+			continue
+		}
+		for _, tag := range candidates[digest] {
+			if other, ok := kept[digest]; ok {
+				statuses = append(statuses, pruneStatus{tag: tag, status: "kept, same image as " + other})
+				continue
+			}
+			if dryRun {
+				statuses = append(statuses, pruneStatus{tag: tag, status: "would delete"})
+				continue
+			}
+			if err := client.Delete(ctx, repo+":"+tag); err != nil {
+				statuses = append(statuses, pruneStatus{tag: tag, status: "failed: " + err.Error(), failed: true})
+				continue
+			}
+			statuses = append(statuses, pruneStatus{tag: tag, status: "deleted"})
+		}
+	}
+	return statuses, nil
+}
+
+// imageCreated returns the creation time of the image, zero when it cannot be read
+func imageCreated(ctx context.Context, client *registry.Client, image string) time.Time {
+	img, err := client.Image(ctx, image)
+	if err != nil {
+		return time.Time{}
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return time.Time{}
+	}
+	return cfg.Created.Time
+}
+
+// pinnedTags returns the tags that move between images and are never pruned: latest, the names of the
+// environments and the literal tags of publish.tags
+func pinnedTags() (map[string]bool, error) {
+	pinned := map[string]bool{"latest": true}
+	if globalFlags.Environment != "" {
+		pinned[globalFlags.Environment] = true
+	}
+	envs, err := filepath.Glob(path.Join(globalFlags.Path, globalFlags.StateDirName, "environments", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range envs {
+		pinned[filepath.Base(env)] = true
+	}
+	for _, tag := range viper.GetStringSlice("publish.tags") {
+		if tag != "environment" && tag != "sha" {
+			pinned[tag] = true
+		}
+	}
+	return pinned, nil
+}
+
+// protectedVersions returns the versions deployed in any environment and the versions in the release
+// history of any environment, with the reason they are protected
+func protectedVersions() (map[string]string, error) {
+	root := path.Join(globalFlags.Path, globalFlags.StateDirName)
+	envs, err := filepath.Glob(path.Join(root, "environments", "*"))
+	if err != nil {
+		return nil, err
+	}
+	protected := map[string]string{}
+	for _, dir := range append([]string{root}, envs...) {
+		name := "the default environment"
+		if dir != root {
+			name = "environment " + filepath.Base(dir)
+		}
+		if b, err := os.ReadFile(path.Join(dir, "VERSION")); err == nil {
+			if v := strings.TrimSpace(string(b)); v != "" {
+				protected[v] = "deployed in " + name
+			}
+		}
+		releases, err := os.ReadDir(path.Join(dir, "releases"))
+		if err != nil {
+			continue
+		}
+		for _, r := range releases {
+			if _, ok := protected[r.Name()]; !ok && r.IsDir() && r.Name() != unreleased {
+				protected[r.Name()] = "released in " + name
+			}
+		}
+	}
+	return protected, nil
+}
@@ -1,16 +1,27 @@
 package cmd
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"os/exec"
-
+	"io"
+	"os"
+	"path"
+	"strings"
 	"time"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/gosuri/uitable"
+	"golang.org/x/term"
+
 	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/registry"
+	"github.com/ovrclk/eve/ui"
+	"github.com/ovrclk/eve/util/gitutil"
+	"github.com/ovrclk/eve/util/versionutil"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var publishFlags *PublishFlags
@@ -19,6 +30,9 @@ var publishFlags *PublishFlags
 type PublishFlags struct {
 	Version  string
 	SkipSave bool
+	Force    bool
+	// ToArchive is the path of the OCI archive to write the images to instead of pushing them
+	ToArchive string
 }
 
 // PublishCmd is the command to publish the image
@@ -37,66 +51,414 @@ func NewPublish(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 		},
 	}
 	bindPublishFlags(publishFlags, publishCmd)
+	publishCmd.Flags().StringVar(&publishFlags.ToArchive, "to-archive", "", "Write the images and their eve metadata to an OCI archive instead of pushing them, see eve load")
+	publishCmd.AddCommand(NewPublishPrune(ctx, cancel))
 	return publishCmd
 }
 
 func bindPublishFlags(flags *PublishFlags, cmd *cobra.Command) {
-	cmd.Flags().StringVarP(&flags.Version, "version", "v", "", "Version of the image")
+	cmd.Flags().StringVarP(&flags.Version, "version", "v", "", "Version of the image, it defaults to the versioning strategy of .eve.yaml")
 	cmd.Flags().BoolVar(&flags.SkipSave, "skip-save", false, "Skip saving the version to the state directory")
+	cmd.Flags().BoolVar(&flags.Force, "force", false, "Overwrite the version if it was already published")
 }
 
 func runPublish(ctx context.Context, cancel context.CancelFunc, image string, flags *PublishFlags) (err error) {
-	if image == "" {
-		if image, err = readvar("IMAGE"); err != nil {
-			return errors.Wrap(err, "failed to read IMAGE variable")
+	services, err := projectServices(image)
+	if err != nil {
+		return err
+	}
+	// if the version is not given, generate it with the versioning strategy
+	if flags.Version, err = resolveVersion(ctx, flags.Version, globalFlags.Path); err != nil {
+		return err
+	}
+	// the registry may not be reachable from where archives are written
+	if flags.ToArchive != "" {
+		return runPublishArchive(ctx, cancel, services, flags)
+	}
+	if !flags.Force {
+		if err := checkVersionUnused(ctx, services, flags.Version); err != nil {
+			return err
 		}
 	}
-	// if the version is not given, set the version to the current time
-	// in ISO8601 format and write the version to the state directory
-	if flags.Version == "" {
-		flags.Version = fmt.Sprint(time.Now().Unix())
 
+	return withHooks(ctx, stagePublish, func() error {
+		var results []*publishResult
+		for _, svc := range services {
+			svc := svc
+			err := runPhase("Publishing "+svc.Name, "publish-"+svc.Name, func(w io.Writer) (string, error) {
+				res, err := publishImage(ctx, cancel, w, svc, flags.Version)
+				results = append(results, res...)
+				if err != nil {
+					return "", err
+				}
+				return "Publishing Complete. Image ready " + svc.Image + ":" + flags.Version, nil
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to publish service %s", svc.Name)
+			}
+		}
+		printPublishSummary(results)
+
+		// the version is saved once all of its images are pushed
+		if !flags.SkipSave {
+			if err := writevar("VERSION", flags.Version); err != nil {
+				return errors.Wrap(err, "failed to write VERSION variable")
+			}
+		}
+		if err := releaseProvenance(flags.Version); err != nil {
+			return err
+		}
+		// the digests pin the version to the pushed images
+		for _, res := range results {
+			if res.Mirror {
+				continue
+			}
+			if err := recordDigest(flags.Version, res.Service, res.Digest); err != nil {
+				return errors.Wrapf(err, "failed to record the digest of service %s", res.Service.Name)
+			}
+		}
+		return publishError(results)
+	})
+}
+
+// resolveVersion returns the version when it is given. Otherwise it generates the version with the
+// strategy of the versioning key of .eve.yaml:
+//
+//	versioning:
+//	  strategy: semver # timestamp, git-sha, git-tag, semver or template
+//	  bump: minor      # major, minor or patch, for semver
+//	  template: "{{.Environment}}-{{.Date}}-{{.ShortSHA}}"
+//
+// Without a strategy, it returns the short SHA of the commit of the last build from git, or the
+// current time. The git strategies read the repository at dir.
+func resolveVersion(ctx context.Context, version, dir string) (string, error) {
+	if version != "" {
+		return version, versionutil.Validate(version)
 	}
-	if !flags.SkipSave && writevar("VERSION", flags.Version) != nil {
-		return errors.Wrap(err, "failed to write VERSION variable")
+	commit, _ := readvar("BUILD_COMMIT")
+	strategy := viper.GetString("versioning.strategy")
+	if strategy == "" {
+		if commit != "" {
+			return gitutil.ShortSHA(commit), nil
+		}
+		return fmt.Sprint(time.Now().Unix()), nil
 	}
 
-	// push the latest version image to the registry
-	if err := dockerPush(ctx, cancel, image); err != nil {
-		return errors.Wrap(err, "failed to push image: "+image)
+	now := time.Now().UTC()
+	data := versionutil.Data{
+		Timestamp:   now.Unix(),
+		Date:        now.Format("20060102"),
+		SHA:         commit,
+		Environment: globalFlags.Environment,
+	}
+	if data.SHA == "" {
+		data.SHA, _, _ = gitutil.Head(ctx, dir)
 	}
+	data.ShortSHA = gitutil.ShortSHA(data.SHA)
+	if strategy == versionutil.GitTag {
+		tag, err := gitutil.Describe(ctx, dir)
+		if err != nil {
+			return "", err
+		}
+		data.Tag = tag
+	}
+	if strategy == versionutil.Semver {
+		versions, err := releasedVersions()
+		if err != nil {
+			return "", err
+		}
+		// versions published before the release history was kept are only in VERSION
+		if last, err := readvar("VERSION"); err == nil && last != "" {
+			versions = append(versions, last)
+		}
+		data.Latest = versionutil.Latest(versions)
+	}
+	return versionutil.Generate(strategy, viper.GetString("versioning.bump"), viper.GetString("versioning.template"), data)
+}
 
-	// tag the image with the version tag
-	c := []string{"tag", image, image + ":" + flags.Version}
-	logger.Debugf("runPublish: running command: docker %v", c)
-	cmd := exec.CommandContext(ctx, "docker", c...)
-	if err := cmd.Run(); err != nil {
-		return errors.Wrap(err, "failed to tag image")
+// checkVersionUnused returns an error when the version is in the release history or its tag is in the
+// registry for one of the services
+func checkVersionUnused(ctx context.Context, services []*Service, version string) error {
+	if err := checkVersionUnreleased(version); err != nil {
+		return err
+	}
+	client := registry.New(registry.Options{})
+	for _, svc := range services {
+		exists, err := client.Exists(ctx, svc.Image+":"+version)
+		if err != nil {
+			// the registry is checked again when publishing
+			logger.Debugf("checkVersionUnused: %v", err)
+			continue
+		}
+		if exists {
+			return errors.Errorf("%s:%s is already in the registry, use --force to overwrite it", svc.Image, version)
+		}
 	}
+	return nil
+}
 
-	// push the tagged image to the registry
-	if err := dockerPush(ctx, cancel, image+":"+flags.Version); err != nil {
-		return errors.Wrap(err, "failed to push image: "+image+":"+flags.Version)
+// checkVersionUnreleased returns an error when the version is in the release history
+func checkVersionUnreleased(version string) error {
+	versions, err := releasedVersions()
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if v == version {
+			return errors.Errorf("version %s was already published, use --force to overwrite it", version)
+		}
 	}
 	return nil
 }
 
-// dockerPush pushes the image to the registry
-func dockerPush(ctx context.Context, cancel context.CancelFunc, image string) (err error) {
-	c := []string{"push", image}
-	logger.Debugf("dockerPush: running command: docker %v", c)
-	cmd := exec.CommandContext(ctx, "docker", c...)
-	r, _ := cmd.StdoutPipe()
-	err = cmd.Start()
+// publishResult is the outcome of publishing the image of a service to a repository
+type publishResult struct {
+	Service    *Service
+	Repository string
+	// Mirror is true for the repositories of the mirrors
+	Mirror bool
+	Tags   []string
+	Digest string
+	Err    error
+}
+
+// publishImage pushes the version of the image of the service to its repository. The image is read
+// from the local docker daemon when it is there, otherwise the image already in the registry, such as
+// one built with pack --publish, is tagged with the version. The version is then tagged with the other
+// tags and copied to the mirrors. It returns the result of each repository, the repository of the
+// image first, and an error when the repository of the image fails.
+func publishImage(ctx context.Context, cancel context.CancelFunc, w io.Writer, svc *Service, version string) ([]*publishResult, error) {
+	client := registry.New(registry.Options{})
+	image := svc.Image
+	res := &publishResult{Service: svc, Repository: image}
+	img, err := registry.Local(ctx, image)
+	if err == nil {
+		// push the version first so that the other tags always point to a complete version
+		fmt.Fprintf(w, "Pushing %s:%s\n", image, version)
+		if err := pushWithProgress(ctx, client, w, img, image+":"+version); err != nil {
+			res.Err = errors.Wrap(err, "failed to push image: "+image)
+			return []*publishResult{res}, res.Err
+		}
+	} else {
+		logger.Debugf("publishImage: local image not available: %v", err)
+		if err := tagRemoteVersion(ctx, client, w, image, version); err != nil {
+			res.Err = err
+			return []*publishResult{res}, err
+		}
+	}
+	results := distributeImage(ctx, w, svc, image+":"+version, publishTags(ctx, version, ""))
+	return results, results[0].Err
+}
+
+// pushWithProgress pushes the image and renders the progress of its layers. On a terminal the layers
+// are redrawn in place on stdout, which the phase cannot indent, and cleared after the push, otherwise
+// a line with the totals is written to w periodically. The final totals and the sizes of the layers
+// are written to w, so the phase and its log keep them.
+func pushWithProgress(ctx context.Context, client *registry.Client, w io.Writer, img v1.Image, ref string) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return errors.Wrap(err, "failed to read the image layers")
+	}
+	terminal := term.IsTerminal(int(os.Stdout.Fd()))
+	out := w
+	if terminal {
+		out = os.Stdout
+	}
+	progress := ui.NewProgress(out, terminal)
+	for _, l := range layers {
+		digest, err := l.Digest()
+		if err != nil {
+			return err
+		}
+		size, err := l.Size()
+		if err != nil {
+			return err
+		}
+		uncompressed, err := partial.UncompressedSize(l)
+		if err != nil {
+			logger.Debugf("pushWithProgress: uncompressed size of %s: %v", digest, err)
+		}
+		progress.AddLayer(digest.String(), size, uncompressed)
+	}
+	progress.Start()
+	_, err = client.Push(ctx, registry.WithLayerProgress(img, func(layer v1.Hash, read int64) {
+		progress.Update(layer.String(), read)
+	}), ref)
+	progress.Stop()
 	if err != nil {
-		return errors.Wrap(err, "error starting push")
+		return err
 	}
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		fmt.Println(scanner.Text())
+	progress.Summary(w)
+	return nil
+}
+
+// tagRemoteVersion tags the image in the registry with the version, unless the version is already there
+func tagRemoteVersion(ctx context.Context, client *registry.Client, w io.Writer, image, version string) error {
+	exists, err := client.Exists(ctx, image+":"+version)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Fprintf(w, "Using %s:%s from the registry\n", image, version)
+		return nil
+	}
+	if exists, err = client.Exists(ctx, image); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Errorf("image %s is neither in the local docker daemon nor in the registry", image)
+	}
+	fmt.Fprintf(w, "Using %s from the registry\n", image)
+	if _, err := client.Tag(ctx, image, version); err != nil {
+		return errors.Wrap(err, "failed to tag image")
+	}
+	return nil
+}
+
+// distributeImage tags src, the version of the image of the service in its repository, with the other
+// tags and copies it with the tags to the mirrors. The tags start with the version, as returned by
+// publishTags. It returns the result of each repository, the repository of the image first.
+func distributeImage(ctx context.Context, w io.Writer, svc *Service, src string, tags []string) []*publishResult {
+	client := registry.New(registry.Options{})
+	version := tags[0]
+
+	primary := &publishResult{Service: svc, Repository: svc.Image}
+	results := []*publishResult{primary}
+	primary.Digest, primary.Err = tagAll(ctx, client, w, src, svc.Image, tags)
+	if primary.Err != nil {
+		return results
+	}
+	primary.Tags = tags
+
+	for _, mirror := range publishMirrors(svc.Image) {
+		res := &publishResult{Service: svc, Repository: mirror, Mirror: true}
+		fmt.Fprintf(w, "Mirroring %s to %s\n", src, mirror)
+		if _, res.Err = client.Copy(ctx, src, mirror+":"+version); res.Err == nil {
+			res.Digest, res.Err = tagAll(ctx, client, w, mirror+":"+version, mirror, tags)
+		}
+		if res.Err == nil {
+			res.Tags = tags
+		} else {
+			fmt.Fprintf(w, "Mirroring to %s failed: %v\n", mirror, res.Err)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// tagAll tags the image, which is the first tag in the repository, with the other tags and returns
+// its digest
+func tagAll(ctx context.Context, client *registry.Client, w io.Writer, image, repository string, tags []string) (string, error) {
+	digest, err := client.Digest(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	for _, tag := range tags[1:] {
+		if _, err := client.Tag(ctx, image, tag); err != nil {
+			return "", err
+		}
+	}
+	for _, tag := range tags {
+		fmt.Fprintf(w, "%s:%s: digest: %s\n", repository, tag, digest)
+	}
+	return digest, nil
+}
+
+// publishTags returns the tags of a published version, the version first. The publish.tags key of
+// .eve.yaml selects the other tags, it defaults to latest, environment and sha:
+//
+//	publish:
+//	  tags: [latest, environment, sha, stable]
+//
+// latest is the latest tag, environment is the name of the environment when one is used, sha is the
+// short SHA of the commit, which defaults to the commit of the last build, and other entries are
+// literal tags.
+func publishTags(ctx context.Context, version, commit string) []string {
+	names := []string{"latest", "environment", "sha"}
+	if viper.IsSet("publish.tags") {
+		names = viper.GetStringSlice("publish.tags")
+	}
+	tags := []string{version}
+	add := func(tag string) {
+		if tag == "" {
+			return
+		}
+		if err := versionutil.Validate(tag); err != nil {
+			logger.Warnf("skipping tag: %v", err)
+			return
+		}
+		for _, t := range tags {
+			if t == tag {
+				return
+			}
+		}
+		tags = append(tags, tag)
+	}
+	for _, name := range names {
+		switch name {
+		case "environment":
+			add(globalFlags.Environment)
+		case "sha":
+			if commit == "" {
+				commit, _ = readvar("BUILD_COMMIT")
+			}
+			if commit == "" {
+				commit, _, _ = gitutil.Head(ctx, globalFlags.Path)
+			}
+			add(gitutil.ShortSHA(commit))
+		default:
+			add(name)
+		}
+	}
+	return tags
+}
+
+// publishMirrors returns the repositories the image is mirrored to. The publish.mirrors key of .eve.yaml
+// lists the registries and their namespaces, the image keeps its name in each of them:
+//
+//	publish:
+//	  mirrors:
+//	    - ghcr.io/acme
+//	    - registry.example.com/mirror
+func publishMirrors(image string) []string {
+	name := path.Base(image)
+	var mirrors []string
+	for _, m := range viper.GetStringSlice("publish.mirrors") {
+		mirrors = append(mirrors, strings.TrimSuffix(m, "/")+"/"+name)
+	}
+	return mirrors
+}
+
+// printPublishSummary prints the result of each repository
+func printPublishSummary(results []*publishResult) {
+	tab := uitable.New()
+	tab.MaxColWidth = 80
+	tab.Wrap = true
+	tab.AddRow("SERVICE", "REPOSITORY", "TAGS", "DIGEST", "STATUS")
+	for _, res := range results {
+		status := "ok"
+		if res.Err != nil {
+			status = "failed: " + res.Err.Error()
+		}
+		digest := res.Digest
+		if len(digest) > 19 {
+			digest = digest[:19]
+		}
+		tab.AddRow(res.Service.Name, res.Repository, strings.Join(res.Tags, ", "), digest, status)
+	}
+	fmt.Println(tab.String())
+}
+
+// publishError returns an error when publishing to one of the repositories failed
+func publishError(results []*publishResult) error {
+	var failed []string
+	for _, res := range results {
+		if res.Err != nil {
+			failed = append(failed, res.Repository)
+		}
 	}
-	if err := cmd.Wait(); err != nil {
-		return errors.Wrap(err, "error waiting for push")
+	if len(failed) > 0 {
+		return errors.Errorf("failed to publish to %s", strings.Join(failed, ", "))
 	}
 	return nil
 }
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/registry"
+	"github.com/ovrclk/eve/ui/prompt"
+	"github.com/ovrclk/eve/util/sdlutil"
+)
+
+// registriesVar is the name of the encrypted registry credentials file in the state directory
+const registriesVar = "REGISTRIES"
+
+// RegistryCredentials are the credentials providers use to pull images from a private registry
+type RegistryCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RegistryLoginFlags contains the flags for the registry login command
+type RegistryLoginFlags struct {
+	Username      string
+	Password      string
+	PasswordStdin bool
+}
+
+// NewRegistry creates a new command to manage the credentials of private registries
+func NewRegistry(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Manage the credentials providers use to pull your images from private registries",
+	}
+	cmd.AddCommand(
+		NewRegistryLogin(ctx, cancel),
+		NewRegistryLogout(ctx, cancel),
+		NewRegistryList(ctx, cancel),
+	)
+	return cmd
+}
+
+func NewRegistryLogin(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &RegistryLoginFlags{}
+	cmd := &cobra.Command{
+		Use:   "login <host>",
+		Short: "Store the credentials of a registry, such as docker.io or ghcr.io",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRegistryLogin(ctx, cancel, args[0], flags)
+		},
+	}
+	cmd.Flags().StringVarP(&flags.Username, "username", "u", "", "Username of the registry")
+	cmd.Flags().StringVarP(&flags.Password, "password", "p", "", "Password or token of the registry, prefer --password-stdin")
+	cmd.Flags().BoolVar(&flags.PasswordStdin, "password-stdin", false, "Read the password or token from stdin")
+	return cmd
+}
+
+func NewRegistryLogout(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout <host>",
+		Short: "Remove the credentials of a registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			creds, err := readRegistryCredentials()
+			if err != nil {
+				return err
+			}
+			host := registry.NormalizeHost(args[0])
+			if _, ok := creds[host]; !ok {
+				return errors.Errorf("not logged in to %s", host)
+			}
+			delete(creds, host)
+			if err := writeEncryptedVar(registriesVar, creds); err != nil {
+				return err
+			}
+			fmt.Printf("Removed the credentials of %s\n", host)
+			return nil
+		},
+	}
+}
+
+func NewRegistryList(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the registries with stored credentials",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			creds, err := readRegistryCredentials()
+			if err != nil {
+				return err
+			}
+			tab := uitable.New().AddRow("HOST", "USERNAME")
+			for _, host := range sortedRegistryHosts(creds) {
+				tab.AddRow(host, creds[host].Username)
+			}
+			fmt.Println(tab.String())
+			return nil
+		},
+	}
+}
+
+func runRegistryLogin(ctx context.Context, cancel context.CancelFunc, host string, flags *RegistryLoginFlags) error {
+	host = registry.NormalizeHost(host)
+	if flags.PasswordStdin {
+		if flags.Password != "" {
+			return errors.New("--password and --password-stdin are mutually exclusive")
+		}
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.Wrap(err, "failed to read the password from stdin")
+		}
+		flags.Password = strings.TrimRight(line, "\r\n")
+	}
+	prompt.String(&flags.Username, "Username: ")
+	if err := prompt.HiddenString(&flags.Password, "Password: "); err != nil {
+		return err
+	}
+	if flags.Username == "" || flags.Password == "" {
+		return errors.New("a username and a password are required")
+	}
+	logger.Mask(flags.Password)
+
+	creds, err := readRegistryCredentials()
+	if err != nil {
+		return err
+	}
+	creds[host] = RegistryCredentials{Username: flags.Username, Password: flags.Password}
+	if err := writeEncryptedVar(registriesVar, creds); err != nil {
+		return err
+	}
+	fmt.Printf("Stored the credentials of %s, they are added to the SDL of the services with images in %s\n", host, host)
+	return nil
+}
+
+// readRegistryCredentials reads the registry credentials of the current environment by host and masks
+// the passwords in the logs
+func readRegistryCredentials() (map[string]RegistryCredentials, error) {
+	creds := map[string]RegistryCredentials{}
+	if err := readEncryptedFile(path.Join(stateDir(), registriesVar), &creds); err != nil {
+		return nil, errors.Wrap(err, "failed to read registry credentials")
+	}
+	for _, c := range creds {
+		logger.Mask(c.Password)
+	}
+	return creds, nil
+}
+
+// mergedRegistryCredentials reads the project wide registry credentials merged with the credentials
+// of the current environment and masks the passwords in the logs
+func mergedRegistryCredentials() (map[string]RegistryCredentials, error) {
+	creds := map[string]RegistryCredentials{}
+	for _, p := range envVarPaths(registriesVar) {
+		if err := readEncryptedFile(p, &creds); err != nil {
+			return nil, errors.Wrap(err, "failed to read registry credentials")
+		}
+	}
+	for _, c := range creds {
+		logger.Mask(c.Password)
+	}
+	return creds, nil
+}
+
+// injectRegistryCredentials sets the credentials of the registry of the image of each service that
+// has credentials
+func injectRegistryCredentials(doc *sdlutil.Document, creds map[string]RegistryCredentials) error {
+	if len(creds) == 0 {
+		return nil
+	}
+	for _, name := range doc.Services() {
+		image, err := doc.Image(name)
+		if err != nil || image == "" {
+			continue
+		}
+		host, err := registry.Host(image)
+		if err != nil {
+			logger.Debugf("injectRegistryCredentials: service %s: %v", name, err)
+			continue
+		}
+		c, ok := creds[host]
+		if !ok {
+			continue
+		}
+		if err := doc.SetCredentials(name, host, c.Username, c.Password); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedRegistryHosts(creds map[string]RegistryCredentials) []string {
+	hosts := make([]string, 0, len(creds))
+	for host := range creds {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
@@ -9,12 +9,12 @@ import (
 	"path"
 	"strings"
 
-	"github.com/gosuri/uitable"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/util/cryptutil"
 	"github.com/ovrclk/eve/util/fsutil"
 )
 
@@ -26,6 +26,10 @@ var (
 type GlobalFlags struct {
 	Path         string
 	StateDirName string
+	// Environment is the name of the environment, such as staging or production. The variables of an
+	// environment are stored under environments/<name> in the state directory and fall back to the
+	// variables of the state directory.
+	Environment string
 }
 
 func init() {
@@ -60,6 +64,7 @@ func NewRootCMD(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 
 	rootCmd.PersistentFlags().StringVar(&globalFlags.Path, "path", "", "Path to the project, it defaults to the current directory")
 	rootCmd.PersistentFlags().StringVar(&globalFlags.StateDirName, "state-dir", defaultStateDir, "Path to the state directory relative to the project path")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.Environment, "environment", os.Getenv("EVE_ENVIRONMENT"), "Name of the environment to use, such as staging or production (env EVE_ENVIRONMENT)")
 
 	rootCmd.AddCommand(
 		NewInit(ctx, cancel),
@@ -71,6 +76,17 @@ func NewRootCMD(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 		NewLogs(ctx, cancel),
 		NewSDL(ctx, cancel),
 		NewDeploy2Cmd(ctx, cancel),
+		NewSecrets(ctx, cancel),
+		NewImport(ctx, cancel),
+		NewConfigSet(ctx, cancel),
+		NewConfigUnset(ctx, cancel),
+		NewConfigList(ctx, cancel),
+		NewInspect(ctx, cancel),
+		NewBuilder(ctx, cancel),
+		NewRegistry(ctx, cancel),
+		NewSign(ctx, cancel),
+		NewPromote(ctx, cancel),
+		NewLoad(ctx, cancel),
 	)
 	return rootCmd
 }
@@ -139,57 +155,58 @@ func NewActions(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 	return actionsCmd
 }
 
-func NewStatus(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
-	statusCmd := &cobra.Command{
-		Use:   "status",
-		Short: "View the status of your application",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			if err := runStatus(ctx, cancel); err != nil {
-				return err
-			}
-			return nil
-		},
+// stateDir returns the state directory of the current environment
+func stateDir() string {
+	if globalFlags.Environment == "" {
+		return path.Join(globalFlags.Path, globalFlags.StateDirName)
 	}
-	return statusCmd
+	return path.Join(globalFlags.Path, globalFlags.StateDirName, "environments", globalFlags.Environment)
 }
 
-func runStatus(ctx context.Context, cancel context.CancelFunc) (err error) {
-	var provider, dseq string
+// cacheDir returns the directory of the rendered files of the current environment
+func cacheDir() string {
+	return path.Join(stateDir(), "cache")
+}
 
-	if provider, err = readvar("PROVIDER"); err != nil {
-		return err
+// varPath returns the path to the variable of the current environment, falling back to
+// the variable of the state directory when the environment does not define it
+func varPath(name string) string {
+	p := path.Join(stateDir(), name)
+	if globalFlags.Environment != "" && !fsutil.FileExists(p) {
+		return path.Join(globalFlags.Path, globalFlags.StateDirName, name)
 	}
+	return p
+}
 
-	if dseq, err = readvar("DSEQ"); err != nil {
-		return err
+// readJSONFile reads the JSON encoded file into v. A missing file leaves v untouched.
+func readJSONFile(p string, v interface{}) error {
+	if !fsutil.FileExists(p) {
+		return nil
 	}
-
-	// fetch the lease status
-	c := []string{"provider", "lease-status", "--provider", provider, "--dseq", dseq, "--from", "deploy"}
-	logger.Debug("runStatus: ", c)
-
-	cmd := exec.CommandContext(ctx, "akash", c...)
-	out, err := cmd.CombinedOutput()
+	b, err := os.ReadFile(p)
 	if err != nil {
-		fmt.Println("runStatus error: ", err)
-		return err
+		return errors.Wrapf(err, "failed to read file %s", p)
 	}
-	logger.Debug("runStatus output: ", string(out))
+	return errors.Wrapf(json.Unmarshal(b, v), "failed to decode %s", p)
+}
 
-	// unmarshal the lease status JSON into a map
-	var result map[string]interface{}
-	if err := json.Unmarshal(out, &result); err != nil { // unmarshal the output into a map
-		return errors.Wrapf(err, "failed to unmarshal output")
+// envVarPaths returns the paths to the variable in the state directory and, when an environment is
+// selected, in the environment. Environment specific values are merged over the project wide ones.
+func envVarPaths(name string) []string {
+	paths := []string{path.Join(globalFlags.Path, globalFlags.StateDirName, name)}
+	if globalFlags.Environment != "" {
+		paths = append(paths, path.Join(stateDir(), name))
 	}
-	logger.Debugf("+%v", result)
+	return paths
+}
 
-	tab := uitable.New().AddRow("SERVICE", "AVAIABLE", "END_POINTS")
-	for _, v := range result["services"].(map[string]interface{}) {
-		svc := v.(map[string]interface{})
-		tab.AddRow(svc["name"], svc["available"], svc["uris"])
+// writeJSONVar writes the JSON encoding of v to the state directory
+func writeJSONVar(name string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
 	}
-	fmt.Println(tab.String())
-	return nil
+	return writevar(name, string(b)+"\n")
 }
 
 // varExists checks if the given variable exists in the environment
@@ -203,7 +220,7 @@ func varExists(name string) bool {
 // readvar reads a variable from the state file
 func readvar(name string) (string, error) {
 	logger.Debug("readvar: ", name)
-	p := path.Join(globalFlags.Path, globalFlags.StateDirName, name) // path to the variable
+	p := varPath(name) // path to the variable
 	if !fsutil.FileExists(p) {
 		return "", errors.Errorf("file missing: %s", p)
 	} // if the file does not exist, return an error
@@ -218,7 +235,10 @@ func readvar(name string) (string, error) {
 // writevar writes a variable to the state file
 func writevar(name, value string) error {
 	logger.Debug("writevar: ", name)
-	p := path.Join(globalFlags.Path, globalFlags.StateDirName, name) // path to the variable
+	p := path.Join(stateDir(), name) // path to the variable
+	if err := os.MkdirAll(stateDir(), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create state directory %s", stateDir())
+	}
 
 	if err := os.WriteFile(p, []byte(value), 0644); err != nil {
 		logger.Error("writevar error: ", err)
@@ -227,6 +247,55 @@ func writevar(name, value string) error {
 	return nil
 }
 
+// readEncryptedFile reads and decrypts the JSON encoded file into v. A missing file leaves v untouched.
+func readEncryptedFile(p string, v interface{}) error {
+	if !fsutil.FileExists(p) {
+		return nil
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read file %s", p)
+	}
+	key, err := cryptutil.LoadKey(secretsKeyFile())
+	if err != nil {
+		return errors.Wrap(err, "failed to load the secrets key")
+	}
+	if b, err = cryptutil.Decrypt(key, b); err != nil {
+		return errors.Wrapf(err, "failed to decrypt %s", p)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// writeEncryptedVar encrypts the JSON encoding of v and writes it to the state directory
+// with owner only permissions
+func writeEncryptedVar(name string, v interface{}) error {
+	logger.Debug("writeEncryptedVar: ", name)
+	p := path.Join(stateDir(), name)
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	key, err := cryptutil.LoadKey(secretsKeyFile())
+	if err != nil {
+		return errors.Wrap(err, "failed to load the secrets key")
+	}
+	if b, err = cryptutil.Encrypt(key, b); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir(), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create state directory %s", stateDir())
+	}
+	if err := os.WriteFile(p, b, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write file %s", p)
+	}
+	return nil
+}
+
+// secretsKeyFile returns the path to the key used to encrypt the state directory secrets
+func secretsKeyFile() string {
+	return os.ExpandEnv("$HOME/.eve/secrets.key")
+}
+
 func stringArrayHelp(name string) string {
 	return fmt.Sprintf("\nRepeat for each %s in order (comma-separated lists not accepted)", name)
 }
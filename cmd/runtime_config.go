@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ovrclk/eve/util/sdlutil"
+)
+
+// configVar is the name of the runtime config file in the state directory
+const configVar = "CONFIG"
+
+// ConfigVar is a runtime environment variable that is merged into the env of the SDL services
+type ConfigVar struct {
+	Value string `json:"value"`
+	// Services the variable is merged into, all services when empty
+	Services []string `json:"services,omitempty"`
+}
+
+// RuntimeConfigFlags contains the flags for the config commands
+type RuntimeConfigFlags struct {
+	Services []string
+	Deploy   bool
+}
+
+func NewConfigSet(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &RuntimeConfigFlags{}
+	cmd := &cobra.Command{
+		Use:   "config:set <KEY=VALUE>...",
+		Short: "Set runtime environment variables of the current environment",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigSet(ctx, cancel, args, flags)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&flags.Services, "service", "s", []string{}, "Service to set the variable for, defaults to all services"+stringArrayHelp("service"))
+	bindRuntimeConfigDeployFlag(flags, cmd)
+	return cmd
+}
+
+func NewConfigUnset(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &RuntimeConfigFlags{}
+	cmd := &cobra.Command{
+		Use:   "config:unset <KEY>...",
+		Short: "Unset runtime environment variables of the current environment",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigUnset(ctx, cancel, args, flags)
+		},
+	}
+	bindRuntimeConfigDeployFlag(flags, cmd)
+	return cmd
+}
+
+func NewConfigList(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "config:list",
+		Short: "List runtime environment variables of the current environment",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vars, err := readConfigVars()
+			if err != nil {
+				return err
+			}
+			tab := uitable.New().AddRow("KEY", "VALUE", "SERVICES")
+			for _, key := range sortedConfigKeys(vars) {
+				services := "*"
+				if svcs := vars[key].Services; len(svcs) > 0 {
+					services = strings.Join(svcs, ",")
+				}
+				tab.AddRow(key, vars[key].Value, services)
+			}
+			fmt.Println(tab.String())
+			return nil
+		},
+	}
+}
+
+func bindRuntimeConfigDeployFlag(flags *RuntimeConfigFlags, cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&flags.Deploy, "deploy", false, "Update the deployment with the new configuration immediately")
+}
+
+func runConfigSet(ctx context.Context, cancel context.CancelFunc, args []string, flags *RuntimeConfigFlags) error {
+	vars, err := readConfigVars()
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		arr := strings.SplitN(arg, "=", 2)
+		if len(arr) != 2 || arr[0] == "" {
+			return errors.Errorf("invalid variable %q, expected the form KEY=VALUE", arg)
+		}
+		vars[arr[0]] = ConfigVar{Value: arr[1], Services: flags.Services}
+	}
+	if err := writeJSONVar(configVar, vars); err != nil {
+		return err
+	}
+	return redeployConfig(ctx, cancel, flags)
+}
+
+func runConfigUnset(ctx context.Context, cancel context.CancelFunc, keys []string, flags *RuntimeConfigFlags) error {
+	vars, err := readConfigVars()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, ok := vars[key]; !ok {
+			return errors.Errorf("variable %s is not set", key)
+		}
+		delete(vars, key)
+	}
+	if err := writeJSONVar(configVar, vars); err != nil {
+		return err
+	}
+	return redeployConfig(ctx, cancel, flags)
+}
+
+// redeployConfig updates the deployment of the current version when the deploy flag is set
+func redeployConfig(ctx context.Context, cancel context.CancelFunc, flags *RuntimeConfigFlags) error {
+	if !flags.Deploy {
+		return nil
+	}
+	dseq, err := readvar("DSEQ")
+	if err != nil {
+		return err
+	}
+	provider, err := readvar("PROVIDER")
+	if err != nil {
+		return err
+	}
+	return runDeployUpdate(ctx, cancel, dseq, provider, &SDLFlags{})
+}
+
+// readConfigVars reads the runtime config of the current environment
+func readConfigVars() (map[string]ConfigVar, error) {
+	vars := map[string]ConfigVar{}
+	if err := readJSONFile(path.Join(stateDir(), configVar), &vars); err != nil {
+		return nil, errors.Wrap(err, "failed to read config")
+	}
+	return vars, nil
+}
+
+// mergedConfigVars reads the project wide runtime config merged with the runtime config of the current environment
+func mergedConfigVars() (map[string]ConfigVar, error) {
+	vars := map[string]ConfigVar{}
+	for _, p := range envVarPaths(configVar) {
+		if err := readJSONFile(p, &vars); err != nil {
+			return nil, errors.Wrap(err, "failed to read config")
+		}
+	}
+	return vars, nil
+}
+
+// injectConfigVars sets the runtime config that applies to any of the names in the env of the service
+// named first, replacing existing values
+func injectConfigVars(doc *sdlutil.Document, names []string, vars map[string]ConfigVar) error {
+	for _, key := range sortedConfigKeys(vars) {
+		if !appliesTo(vars[key].Services, names...) {
+			continue
+		}
+		if err := doc.SetEnv(names[0], key, vars[key].Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedConfigKeys(vars map[string]ConfigVar) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
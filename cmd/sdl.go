@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"path"
 
 	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/util/fsutil"
+	"github.com/ovrclk/eve/util/sdlutil"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
+	"github.com/spf13/viper"
 )
 
-type SDLFlags struct{}
+// SDLFlags is the set of flags used to render the SDL
+type SDLFlags struct {
+	// PinDigest references the images by the digest recorded at publish time instead of the version tag
+	PinDigest bool
+}
 
 func NewSDL(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 	sdlFlags := &SDLFlags{}
@@ -25,57 +34,185 @@ func NewSDL(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
 			return runSDL(ctx, cancel, source, sdlFlags)
 		},
 	}
+	bindSDLFlags(sdlFlags, cmd)
+	cmd.AddCommand(NewSDLFmt(ctx, cancel))
 	return cmd
 }
 
-func runSDL(ctx context.Context, cancel context.CancelFunc, source string, flags *SDLFlags) error {
-	logger.Debug("runSDL:", "source", source)
+func bindSDLFlags(flags *SDLFlags, cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&flags.PinDigest, "pin-digest", false, "Reference the images by the digest recorded at publish time, pin_digest in .eve.yaml enables it by default")
+}
+
+// NewSDLFmt creates a new command that normalizes the formatting of SDL files in place
+func NewSDLFmt(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "fmt [file]...",
+		Short: "Normalize the formatting of SDL files in place, it defaults to sdl.yml",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = []string{"sdl.yml"}
+			}
+			for _, source := range args {
+				if err := runSDLFmt(ctx, cancel, source); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func runSDLFmt(ctx context.Context, cancel context.CancelFunc, source string) error {
 	p := path.Join(globalFlags.Path, source)
-	//b,var b byte[]
+	logger.Debug("runSDLFmt: ", p)
 	b, err := os.ReadFile(p)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", p)
+	}
+	out, err := sdlutil.Format(b)
+	if err != nil {
+		return errors.Wrapf(err, "failed to format %s", p)
+	}
+	if bytes.Equal(b, out) {
+		return nil
+	}
+	info, err := os.Stat(p)
 	if err != nil {
 		return err
 	}
+	if err := os.WriteFile(p, out, info.Mode().Perm()); err != nil {
+		return errors.Wrapf(err, "failed to write %s", p)
+	}
+	fmt.Println(source)
+	return nil
+}
 
-	// create a cache directory under the state directory if it doesn't exist
-	cacheDir := path.Join(globalFlags.Path, globalFlags.StateDirName, "cache")
-	if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
-		err = os.Mkdir(cacheDir, 0755)
+func runSDL(ctx context.Context, cancel context.CancelFunc, source string, flags *SDLFlags) error {
+	return withHooks(ctx, stageSDL, func() error {
+		logger.Debug("runSDL:", "source", source)
+		p := path.Join(globalFlags.Path, source)
+		//b,var b byte[]
+		b, err := os.ReadFile(p)
 		if err != nil {
 			return err
 		}
-	}
 
-	// read the IMAGE variable
-	image, err := readvar("IMAGE")
-	if err != nil {
-		return err
-	}
+		// create a cache directory under the state directory if it doesn't exist
+		cacheDir := cacheDir()
+		if _, err := os.Stat(cacheDir); os.IsNotExist(err) {
+			err = os.MkdirAll(cacheDir, 0755)
+			if err != nil {
+				return err
+			}
+		}
 
-	version, err := readvar("VERSION")
-	if err != nil {
-		return err
-	}
+		// read the images of the services
+		services, err := projectServices("")
+		if err != nil {
+			return err
+		}
 
-	image = image + ":" + version
+		version, err := readvar("VERSION")
+		if err != nil {
+			return err
+		}
 
-	// parse YAML file
-	var data map[string]interface{}
-	if err := yaml.Unmarshal(b, &data); err != nil {
-		return err
-	}
-	data["services"].(map[string]interface{})["web"].(map[string]interface{})["image"] = image
+		// parse the SDL into a node tree to preserve comments, anchors and key order
+		doc, err := sdlutil.Parse(b)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", p)
+		}
+		pinDigest := flags.PinDigest || viper.GetBool("pin_digest")
+		var digests map[string]string
+		if pinDigest {
+			if digests, err = publishedDigests(version); err != nil {
+				return err
+			}
+		}
+		for _, svc := range services {
+			image := svc.Image + ":" + version
+			if pinDigest {
+				digest, ok := digests[svc.Name]
+				if !ok {
+					return errors.Errorf("no digest recorded for service %s at version %s, publish the version to record it", svc.Name, version)
+				}
+				image = svc.Image + "@" + digest
+			}
+			if err := doc.SetImage(svc.Name, image); err != nil {
+				return err
+			}
+		}
 
-	// write the new YAML file
-	b, err = yaml.Marshal(data)
-	if err != nil {
-		return err
-	}
+		// add the services of the process types
+		processServices, err := syncProcesses(doc, services, version)
+		if err != nil {
+			return err
+		}
 
-	target := path.Join(cacheDir, "sdl."+version+".yml")
-	if err := os.WriteFile(target, b, 0644); err != nil {
-		return err
+		// add the credentials of the private registries of the images
+		creds, err := mergedRegistryCredentials()
+		if err != nil {
+			return err
+		}
+		if err := injectRegistryCredentials(doc, creds); err != nil {
+			return err
+		}
+
+		// merge the runtime config and then the secrets into the env of the services, the
+		// process services receive the variables of their service
+		vars, err := mergedConfigVars()
+		if err != nil {
+			return err
+		}
+		secrets, err := mergedSecrets()
+		if err != nil {
+			return err
+		}
+		for _, name := range doc.Services() {
+			names := []string{name}
+			if base, ok := processServices[name]; ok {
+				names = append(names, base)
+			}
+			if err := injectConfigVars(doc, names, vars); err != nil {
+				return err
+			}
+			if err := injectSecrets(doc, names, secrets); err != nil {
+				return err
+			}
+		}
+
+		// write the new YAML file
+		b, err = doc.Bytes()
+		if err != nil {
+			return err
+		}
+
+		// the rendered SDL holds secrets and credentials in plain text, restrict it to the owner. It is
+		// replaced rather than rewritten, as a rewrite keeps the permissions of a previous render.
+		perm := os.FileMode(0644)
+		if len(secrets) > 0 || len(creds) > 0 {
+			perm = 0600
+		}
+		target := path.Join(cacheDir, "sdl."+version+".yml")
+		if err := fsutil.WriteFile(target, b, perm); err != nil {
+			return err
+		}
+		logger.Infof("SDL: updated %s", p)
+		return nil
+	})
+}
+
+// injectSecrets sets the secrets that apply to any of the names in the env of the service named
+// first, replacing existing values
+func injectSecrets(doc *sdlutil.Document, names []string, secrets map[string]Secret) error {
+	for _, key := range sortedSecretNames(secrets) {
+		secret := secrets[key]
+		if !appliesTo(secret.Services, names...) {
+			continue
+		}
+		if err := doc.SetEnv(names[0], key, secret.Value); err != nil {
+			return err
+		}
 	}
-	logger.Infof("SDL: updated %s", p)
 	return nil
 }
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ovrclk/eve/logger"
+)
+
+// secretsVar is the name of the encrypted secrets file in the state directory
+const secretsVar = "SECRETS"
+
+// Secret is a runtime secret that is injected into the env of the SDL services
+type Secret struct {
+	Value string `json:"value"`
+	// Services the secret is injected into, all services when empty
+	Services []string `json:"services,omitempty"`
+}
+
+// appliesTo returns true if any of the names is one of the services, or if no services are given
+func appliesTo(services []string, names ...string) bool {
+	if len(services) == 0 {
+		return true
+	}
+	for _, svc := range services {
+		for _, name := range names {
+			if svc == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SecretsFlags contains the flags for the secrets commands
+type SecretsFlags struct {
+	Services []string
+}
+
+// NewSecrets creates a new command to manage the runtime secrets
+func NewSecrets(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage encrypted runtime secrets of your application",
+	}
+	cmd.AddCommand(
+		NewSecretsSet(ctx, cancel),
+		NewSecretsGet(ctx, cancel),
+		NewSecretsList(ctx, cancel),
+		NewSecretsRm(ctx, cancel),
+	)
+	return cmd
+}
+
+func NewSecretsSet(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &SecretsFlags{}
+	cmd := &cobra.Command{
+		Use:   "set <NAME=VALUE>...",
+		Short: "Set one or more secrets",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSecretsSet(ctx, cancel, args, flags)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&flags.Services, "service", "s", []string{}, "Service to inject the secret into, defaults to all services"+stringArrayHelp("service"))
+	return cmd
+}
+
+func NewSecretsGet(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <NAME>",
+		Short: "Print the value of a secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secrets, err := readSecrets()
+			if err != nil {
+				return err
+			}
+			secret, ok := secrets[args[0]]
+			if !ok {
+				return errors.Errorf("secret %s not found", args[0])
+			}
+			fmt.Println(secret.Value)
+			return nil
+		},
+	}
+}
+
+func NewSecretsList(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the secrets and the services they are injected into",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secrets, err := readSecrets()
+			if err != nil {
+				return err
+			}
+			tab := uitable.New().AddRow("NAME", "SERVICES")
+			for _, name := range sortedSecretNames(secrets) {
+				services := "*"
+				if svcs := secrets[name].Services; len(svcs) > 0 {
+					services = strings.Join(svcs, ",")
+				}
+				tab.AddRow(name, services)
+			}
+			fmt.Println(tab.String())
+			return nil
+		},
+	}
+}
+
+func NewSecretsRm(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <NAME>...",
+		Short: "Remove one or more secrets",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secrets, err := readSecrets()
+			if err != nil {
+				return err
+			}
+			for _, name := range args {
+				if _, ok := secrets[name]; !ok {
+					return errors.Errorf("secret %s not found", name)
+				}
+				delete(secrets, name)
+			}
+			return writeEncryptedVar(secretsVar, secrets)
+		},
+	}
+}
+
+func runSecretsSet(ctx context.Context, cancel context.CancelFunc, args []string, flags *SecretsFlags) error {
+	secrets, err := readSecrets()
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		arr := strings.SplitN(arg, "=", 2)
+		if len(arr) != 2 || arr[0] == "" {
+			return errors.Errorf("invalid secret %q, expected the form NAME=VALUE", arg)
+		}
+		secrets[arr[0]] = Secret{Value: arr[1], Services: flags.Services}
+	}
+	return writeEncryptedVar(secretsVar, secrets)
+}
+
+// readSecrets reads the secrets of the current environment and masks their values in the logs
+func readSecrets() (map[string]Secret, error) {
+	secrets := map[string]Secret{}
+	if err := readEncryptedFile(path.Join(stateDir(), secretsVar), &secrets); err != nil {
+		return nil, errors.Wrap(err, "failed to read secrets")
+	}
+	for _, s := range secrets {
+		logger.Mask(s.Value)
+	}
+	return secrets, nil
+}
+
+// mergedSecrets reads the project wide secrets merged with the secrets of the current environment
+// and masks their values in the logs
+func mergedSecrets() (map[string]Secret, error) {
+	secrets := map[string]Secret{}
+	for _, p := range envVarPaths(secretsVar) {
+		if err := readEncryptedFile(p, &secrets); err != nil {
+			return nil, errors.Wrap(err, "failed to read secrets")
+		}
+	}
+	for _, s := range secrets {
+		logger.Mask(s.Value)
+	}
+	return secrets, nil
+}
+
+func sortedSecretNames(secrets map[string]Secret) []string {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
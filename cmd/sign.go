@@ -0,0 +1,345 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/ovrclk/eve/logger"
+	"github.com/ovrclk/eve/registry"
+	"github.com/ovrclk/eve/signing"
+	"github.com/ovrclk/eve/util/fsutil"
+)
+
+const (
+	// signingKeyEnv is the environment variable that holds the PEM encoded signing key, such as in CI
+	signingKeyEnv = "EVE_SIGNING_KEY"
+	// defaultPublicKey is the public key file in the project, meant to be committed
+	defaultPublicKey = "eve.pub"
+
+	// signature storages
+	storageRegistry = "registry"
+	storageState    = "state"
+)
+
+// SignFlags contains the flags for the sign command
+type SignFlags struct {
+	Key     string
+	Storage string
+}
+
+// NewSign creates a new command to sign the published images of a version
+func NewSign(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &SignFlags{}
+	cmd := &cobra.Command{
+		Use:   "sign [version]",
+		Short: "Sign the published image digests of a version, it defaults to the current version",
+		Long: `Sign the published image digests of a version with the signing key, it defaults to the current version.
+
+The signatures are cosign compatible. They are stored in the registry as sha256-<hex>.sig tags, or in
+the release history of the state directory with --storage state. The keys are configured in .eve.yaml:
+
+  signing:
+    private_key: ~/.eve/signing.key # the EVE_SIGNING_KEY environment variable takes precedence
+    public_key: eve.pub             # relative to the project
+    protected_environments: [production]
+
+Deploys to protected environments refuse images without a valid signature, "default" protects
+deploys without an environment. Their SDL references the images by the signed digests, as with
+--pin-digest, and eve deploy update-deployment and update-manifest are refused.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := versionArg(args)
+			if err != nil {
+				return err
+			}
+			return runSign(ctx, cancel, version, flags)
+		},
+	}
+	cmd.Flags().StringVar(&flags.Key, "key", "", "Path to the private key, it defaults to signing.private_key of .eve.yaml")
+	cmd.Flags().StringVar(&flags.Storage, "storage", storageRegistry, "Where to store the signatures, registry or state")
+	cmd.AddCommand(NewSignKeygen(ctx, cancel), NewSignVerify(ctx, cancel))
+	return cmd
+}
+
+func NewSignKeygen(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate the signing keypair",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			priv, pub := privateKeyPath(""), publicKeyPath()
+			if !force && (fsutil.FileExists(priv) || fsutil.FileExists(pub)) {
+				return errors.Errorf("%s or %s already exists, use --force to replace the keypair", priv, pub)
+			}
+			if err := signing.GenerateKey(priv, pub); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote the private key to %s and the public key to %s\n", priv, pub)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Replace the existing keypair")
+	return cmd
+}
+
+func NewSignVerify(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify [version]",
+		Short: "Verify the signatures of the published images of a version, it defaults to the current version",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := versionArg(args)
+			if err != nil {
+				return err
+			}
+			return verifySignatures(ctx, version, true)
+		},
+	}
+}
+
+func runSign(ctx context.Context, cancel context.CancelFunc, version string, flags *SignFlags) error {
+	if flags.Storage != storageRegistry && flags.Storage != storageState {
+		return errors.Errorf("invalid storage %q, expected registry or state", flags.Storage)
+	}
+	key, err := readSigningKey(flags.Key)
+	if err != nil {
+		return err
+	}
+	services, err := projectServices("")
+	if err != nil {
+		return err
+	}
+	client := registry.New(registry.Options{})
+	tab := uitable.New().AddRow("SERVICE", "DIGEST", "SIGNATURE")
+	for _, svc := range services {
+		digest, err := versionDigest(ctx, client, svc, version)
+		if err != nil {
+			return err
+		}
+		sig, err := signing.Sign(key, svc.Image, digest)
+		if err != nil {
+			return err
+		}
+		location := path.Join(releaseDir(version), "signatures", svc.Name+".json")
+		if flags.Storage == storageState {
+			err = storeStateSignature(svc, version, sig)
+		} else {
+			location = svc.Image + ":" + signing.Tag(digest)
+			err = storeRegistrySignature(ctx, client, svc, digest, sig)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to store the signature of service %s", svc.Name)
+		}
+		tab.AddRow(svc.Name, digest, location)
+	}
+	fmt.Println(tab.String())
+	return nil
+}
+
+// versionArg returns the version of the arguments, or the current version
+func versionArg(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	version, err := readvar("VERSION")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read VERSION variable")
+	}
+	return version, nil
+}
+
+// versionDigest returns the digest recorded when the version of the service was published, or the
+// digest of the version tag in the registry
+func versionDigest(ctx context.Context, client *registry.Client, svc *Service, version string) (string, error) {
+	digests, err := publishedDigests(version)
+	if err != nil {
+		return "", err
+	}
+	if digest, ok := digests[svc.Name]; ok {
+		return digest, nil
+	}
+	return client.Digest(ctx, svc.Image+":"+version)
+}
+
+// storeStateSignature adds the signature to the signatures of the service in the release history
+func storeStateSignature(svc *Service, version string, sig *signing.Signature) error {
+	dir := path.Join(releaseDir(version), "signatures")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var sigs []*signing.Signature
+	p := path.Join(dir, svc.Name+".json")
+	if err := readJSONFile(p, &sigs); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(append(sigs, sig), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0644)
+}
+
+// storeRegistrySignature adds the signature to the signature image of the digest in the repository
+// of the service
+func storeRegistrySignature(ctx context.Context, client *registry.Client, svc *Service, digest string, sig *signing.Signature) error {
+	sigs, err := registrySignatures(ctx, client, svc, digest)
+	if err != nil {
+		return err
+	}
+	img, err := signing.Image(append(sigs, sig))
+	if err != nil {
+		return err
+	}
+	_, err = client.Push(ctx, img, svc.Image+":"+signing.Tag(digest))
+	return err
+}
+
+// registrySignatures returns the signatures of the digest in the repository of the service
+func registrySignatures(ctx context.Context, client *registry.Client, svc *Service, digest string) ([]*signing.Signature, error) {
+	ref := svc.Image + ":" + signing.Tag(digest)
+	exists, err := client.Exists(ctx, ref)
+	if err != nil || !exists {
+		return nil, err
+	}
+	img, err := client.Image(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return signing.Signatures(img)
+}
+
+// verifySignatures returns an error unless the published image of each service of the version has a
+// signature of the public key, in the registry or in the release history. When print is true, the
+// result of each service is printed.
+func verifySignatures(ctx context.Context, version string, print bool) error {
+	key, err := readPublicKey()
+	if err != nil {
+		return err
+	}
+	services, err := projectServices("")
+	if err != nil {
+		return err
+	}
+	client := registry.New(registry.Options{})
+	tab := uitable.New().AddRow("SERVICE", "DIGEST", "STATUS")
+	var failed []string
+	for _, svc := range services {
+		digest, err := versionDigest(ctx, client, svc, version)
+		if err == nil {
+			err = verifyServiceSignature(ctx, client, key, svc, version, digest)
+		}
+		status := "verified"
+		if err != nil {
+			status = err.Error()
+			failed = append(failed, svc.Name)
+		}
+		tab.AddRow(svc.Name, digest, status)
+	}
+	if print {
+		fmt.Println(tab.String())
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("no valid signature for version %s of %s", version, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func verifyServiceSignature(ctx context.Context, client *registry.Client, key *ecdsa.PublicKey, svc *Service, version, digest string) error {
+	var sigs []*signing.Signature
+	if err := readJSONFile(path.Join(releaseDir(version), "signatures", svc.Name+".json"), &sigs); err != nil {
+		return err
+	}
+	remote, err := registrySignatures(ctx, client, svc, digest)
+	if err != nil {
+		return err
+	}
+	sigs = append(sigs, remote...)
+	if len(sigs) == 0 {
+		return errors.New("unsigned")
+	}
+	for _, sig := range sigs {
+		err = sig.Verify(key, digest)
+		if err == nil {
+			return nil
+		}
+		logger.Debugf("verifyServiceSignature: %s: %v", svc.Name, err)
+	}
+	return errors.Wrap(err, "no signature verifies")
+}
+
+// protectedEnvironment returns true when deploys to the current environment require signed images
+func protectedEnvironment() bool {
+	current := globalFlags.Environment
+	if current == "" {
+		current = defaultEnvironment
+	}
+	for _, env := range viper.GetStringSlice("signing.protected_environments") {
+		if env == current {
+			return true
+		}
+	}
+	return false
+}
+
+// privateKeyPath returns the path to the private key, the flag takes precedence over the config
+func privateKeyPath(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	if p := viper.GetString("signing.private_key"); p != "" {
+		return expandHome(p)
+	}
+	return os.ExpandEnv("$HOME/.eve/signing.key")
+}
+
+// publicKeyPath returns the path to the public key of the project
+func publicKeyPath() string {
+	p := viper.GetString("signing.public_key")
+	if p == "" {
+		p = defaultPublicKey
+	}
+	p = expandHome(p)
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(globalFlags.Path, p)
+}
+
+func expandHome(p string) string {
+	if strings.HasPrefix(p, "~/") {
+		return os.ExpandEnv("$HOME") + p[1:]
+	}
+	return p
+}
+
+// readSigningKey reads the private key from the EVE_SIGNING_KEY environment variable or the key file
+func readSigningKey(flag string) (*ecdsa.PrivateKey, error) {
+	b := []byte(os.Getenv(signingKeyEnv))
+	if len(b) == 0 || flag != "" {
+		p := privateKeyPath(flag)
+		var err error
+		if b, err = os.ReadFile(p); err != nil {
+			return nil, errors.Wrapf(err, "failed to read the signing key, run 'eve sign keygen' to create one")
+		}
+	}
+	return signing.ParsePrivateKey(b)
+}
+
+func readPublicKey() (*ecdsa.PublicKey, error) {
+	b, err := os.ReadFile(publicKeyPath())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the public key")
+	}
+	return signing.ParsePublicKey(b)
+}
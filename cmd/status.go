@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/ovrclk/eve/lease"
+	"github.com/ovrclk/eve/logger"
+)
+
+// StatusFlags contains the flags for the status command
+type StatusFlags struct {
+	Watch    bool
+	Interval time.Duration
+}
+
+// leaseInfo is the lease of the deployment on chain
+type leaseInfo struct {
+	Owner  string
+	Host   string
+	State  string
+	Price  lease.Coin
+	Escrow lease.Coin
+}
+
+func NewStatus(ctx context.Context, cancel context.CancelFunc) *cobra.Command {
+	flags := &StatusFlags{}
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "View the status of your application",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStatus(ctx, cancel, flags)
+		},
+	}
+	statusCmd.Flags().BoolVarP(&flags.Watch, "watch", "w", false, "Refresh the status until interrupted")
+	statusCmd.Flags().DurationVar(&flags.Interval, "interval", 5*time.Second, "Interval of the refreshes with --watch")
+	return statusCmd
+}
+
+func runStatus(ctx context.Context, cancel context.CancelFunc, flags *StatusFlags) (err error) {
+	var provider, dseq string
+
+	if provider, err = readvar("PROVIDER"); err != nil {
+		return err
+	}
+
+	if dseq, err = readvar("DSEQ"); err != nil {
+		return err
+	}
+
+	info := &leaseInfo{}
+	if !flags.Watch {
+		out, err := renderStatus(ctx, provider, dseq, info)
+		if err != nil {
+			return err
+		}
+		fmt.Print(out)
+		return nil
+	}
+	if flags.Interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+
+	// on a terminal the previous status is cleared, otherwise each status follows the previous one
+	terminal := term.IsTerminal(int(os.Stdout.Fd()))
+	ticker := time.NewTicker(flags.Interval)
+	defer ticker.Stop()
+	lines := 0
+	for {
+		out, err := renderStatus(ctx, provider, dseq, info)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			// keep watching, the provider may be restarting
+			out = "error: " + err.Error() + "\n"
+		}
+		out = fmt.Sprintf("Every %s, updated at %s\n\n%s", flags.Interval, time.Now().Format("15:04:05"), out)
+		if lines > 0 {
+			if terminal {
+				fmt.Printf("\x1b[%dA\x1b[J", lines)
+			} else {
+				fmt.Println()
+			}
+		}
+		fmt.Print(out)
+		lines = strings.Count(out, "\n")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderStatus returns the status of the services reported by the provider and the lease details on
+// chain. The lease details are best effort, they are queried into info.
+func renderStatus(ctx context.Context, provider, dseq string, info *leaseInfo) (string, error) {
+	// fetch the lease status
+	c := []string{"provider", "lease-status", "--provider", provider, "--dseq", dseq, "--from", "deploy"}
+	logger.Debug("runStatus: ", c)
+	out, err := commandOutput(ctx, "akash", c...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch the lease status")
+	}
+	logger.Debug("runStatus output: ", out)
+	status, err := lease.DecodeStatus([]byte(out))
+	if err != nil {
+		return "", err
+	}
+	queryLeaseInfo(ctx, provider, dseq, info)
+
+	tab := uitable.New()
+	tab.MaxColWidth = 60
+	tab.Wrap = true
+	tab.AddRow("SERVICE", "READY", "URIS", "FORWARDED_PORTS", "IPS")
+	for _, name := range status.ServiceNames() {
+		svc := status.Services[name]
+		var ports, ips []string
+		for _, p := range status.ForwardedPorts[name] {
+			ports = append(ports, p.String())
+		}
+		for _, ip := range status.IPs[name] {
+			ips = append(ips, ip.String())
+		}
+		tab.AddRow(name, svc.Ready(), listOrDash(svc.URIs), listOrDash(ports), listOrDash(ips))
+	}
+
+	details := uitable.New()
+	host := provider
+	if info.Host != "" {
+		host += " (" + info.Host + ")"
+	}
+	details.AddRow("PROVIDER", host)
+	details.AddRow("DSEQ", dseq)
+	details.AddRow("STATE", stringOrDash(info.State))
+	price := info.Price.String()
+	if info.Price.Amount != "" {
+		price += "/block"
+	}
+	details.AddRow("PRICE", price)
+	details.AddRow("ESCROW", info.Escrow.String())
+	return tab.String() + "\n\n" + details.String() + "\n", nil
+}
+
+// queryLeaseInfo queries the lease and the escrow balance of the deployment, and the owner and the
+// provider host unless info has them. The queries that fail leave their fields unchanged.
+func queryLeaseInfo(ctx context.Context, provider, dseq string, info *leaseInfo) {
+	if info.Host == "" {
+		if out, err := commandOutput(ctx, "akash", "query", "provider", "get", provider, "-o", "json"); err != nil {
+			logger.Debugf("queryLeaseInfo: provider: %v", err)
+		} else if p, err := lease.DecodeProvider([]byte(out)); err == nil {
+			info.Host = p.HostURI
+		}
+	}
+	if info.Owner == "" {
+		owner, err := commandOutput(ctx, "akash", "keys", "show", "deploy", "-a")
+		if err != nil {
+			logger.Debugf("queryLeaseInfo: owner: %v", err)
+			return
+		}
+		info.Owner = owner
+	}
+	out, err := commandOutput(ctx, "akash", "query", "market", "lease", "list", "--owner", info.Owner,
+		"--dseq", dseq, "--provider", provider, "-o", "json")
+	if err != nil {
+		logger.Debugf("queryLeaseInfo: lease: %v", err)
+	} else if leases, err := lease.DecodeLeases([]byte(out)); err != nil {
+		logger.Debugf("queryLeaseInfo: lease: %v", err)
+	} else if len(leases) > 0 {
+		info.State = leases[0].Lease.State
+		info.Price = leases[0].Lease.Price
+	}
+	out, err = commandOutput(ctx, "akash", "query", "deployment", "get", "--owner", info.Owner, "--dseq", dseq, "-o", "json")
+	if err != nil {
+		logger.Debugf("queryLeaseInfo: deployment: %v", err)
+	} else if d, err := lease.DecodeDeployment([]byte(out)); err != nil {
+		logger.Debugf("queryLeaseInfo: deployment: %v", err)
+	} else {
+		info.Escrow = d.EscrowAccount.Balance
+	}
+}
+
+func listOrDash(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ", ")
+}
+
+func stringOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
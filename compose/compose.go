@@ -0,0 +1,541 @@
+// Package compose translates docker-compose files into Akash SDL documents.
+package compose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ovrclk/eve/util/envutil"
+)
+
+// Defaults applied to services that do not declare resource limits
+var (
+	DefaultCPU     = 0.5
+	DefaultMemory  = "512Mi"
+	DefaultStorage = "1Gi"
+	DefaultPrice   = 1000
+)
+
+// File is the subset of the compose specification that eve reads
+type File struct {
+	Services map[string]Service   `yaml:"services"`
+	Volumes  map[string]yaml.Node `yaml:"volumes"`
+	Networks map[string]yaml.Node `yaml:"networks"`
+	Secrets  map[string]yaml.Node `yaml:"secrets"`
+	Configs  map[string]yaml.Node `yaml:"configs"`
+	Extra    map[string]yaml.Node `yaml:",inline"`
+}
+
+// Service is a compose service
+type Service struct {
+	Image       string               `yaml:"image"`
+	Build       yaml.Node            `yaml:"build"`
+	Command     yaml.Node            `yaml:"command"`
+	Entrypoint  yaml.Node            `yaml:"entrypoint"`
+	Environment yaml.Node            `yaml:"environment"`
+	EnvFile     yaml.Node            `yaml:"env_file"`
+	Ports       []yaml.Node          `yaml:"ports"`
+	Expose      []yaml.Node          `yaml:"expose"`
+	DependsOn   yaml.Node            `yaml:"depends_on"`
+	Links       []string             `yaml:"links"`
+	Volumes     []yaml.Node          `yaml:"volumes"`
+	Deploy      Deploy               `yaml:"deploy"`
+	Extra       map[string]yaml.Node `yaml:",inline"`
+}
+
+// Deploy is the compose deploy section of a service
+type Deploy struct {
+	Replicas  *int `yaml:"replicas"`
+	Resources struct {
+		Limits struct {
+			CPUs   string `yaml:"cpus"`
+			Memory string `yaml:"memory"`
+		} `yaml:"limits"`
+	} `yaml:"resources"`
+}
+
+// Result is the outcome of a translation
+type Result struct {
+	SDL *SDL
+	// Builds maps the services that have to be built to their build context
+	Builds map[string]string
+	// Warnings lists the compose features that could not be translated
+	Warnings []string
+}
+
+func (r *Result) warnf(format string, v ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, v...))
+}
+
+// Convert translates the compose file contents into an SDL. Relative paths, such as env
+// files and build contexts, are resolved against dir.
+func Convert(b []byte, dir string) (*Result, error) {
+	var f File
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, errors.Wrap(err, "failed to parse compose file")
+	}
+	if len(f.Services) == 0 {
+		return nil, errors.New("compose file does not define any services")
+	}
+
+	res := &Result{SDL: NewSDL(), Builds: map[string]string{}}
+	for _, key := range sortedKeys(f.Extra) {
+		if key != "version" && !strings.HasPrefix(key, "x-") {
+			res.warnf("top-level %q is not supported and was ignored", key)
+		}
+	}
+	if len(f.Networks) > 0 {
+		res.warnf("networks are not supported, services can reach each other by name on Akash")
+	}
+	if len(f.Secrets) > 0 || len(f.Configs) > 0 {
+		res.warnf("compose secrets and configs are not supported, use 'eve secrets set' instead")
+	}
+
+	dependents, err := dependents(res, &f)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sortedKeys(f.Services) {
+		if err := convertService(res, &f, name, f.Services[name], dir, dependents[name]); err != nil {
+			return nil, errors.Wrapf(err, "service %s", name)
+		}
+	}
+	return res, nil
+}
+
+// dependents returns the services that reference each service with depends_on or links, in order. The
+// references are checked, and only expose ports on Akash: the startup order is not enforced and the
+// link aliases are dropped.
+func dependents(res *Result, f *File) (map[string][]string, error) {
+	deps := map[string][]string{}
+	add := func(from, to string) {
+		for _, d := range deps[to] {
+			if d == from {
+				return
+			}
+		}
+		deps[to] = append(deps[to], from)
+	}
+	for _, name := range sortedKeys(f.Services) {
+		cs := f.Services[name]
+		var refs []string
+		switch cs.DependsOn.Kind {
+		case 0:
+		case yaml.SequenceNode:
+			if err := cs.DependsOn.Decode(&refs); err != nil {
+				return nil, errors.Wrapf(err, "service %s: depends_on", name)
+			}
+		case yaml.MappingNode:
+			var m map[string]yaml.Node
+			if err := cs.DependsOn.Decode(&m); err != nil {
+				return nil, errors.Wrapf(err, "service %s: depends_on", name)
+			}
+			refs = sortedKeys(m)
+		default:
+			return nil, errors.Errorf("service %s: depends_on: expected a map or a list", name)
+		}
+		if len(refs) > 0 {
+			res.warnf("%s: depends_on exposes the ports of the dependencies to the service, the startup order is not enforced", name)
+		}
+		for _, link := range cs.Links {
+			parts := strings.SplitN(link, ":", 2)
+			if len(parts) == 2 && parts[1] != parts[0] {
+				res.warnf("%s: alias %q of link %q is not supported, use the service name", name, parts[1], parts[0])
+			}
+			refs = append(refs, parts[0])
+		}
+		for _, ref := range refs {
+			if _, ok := f.Services[ref]; !ok {
+				return nil, errors.Errorf("service %s: references undefined service %q", name, ref)
+			}
+			add(name, ref)
+		}
+	}
+	return deps, nil
+}
+
+// convertService translates the compose service. The published ports are exposed globally and to the
+// dependents, the services that reference it. The ports of expose are exposed to the dependents, or to
+// every other service when none does.
+func convertService(res *Result, f *File, name string, cs Service, dir string, dependents []string) error {
+	svc := &SDLService{Image: cs.Image}
+
+	// build contexts
+	if !cs.Build.IsZero() {
+		context, err := buildContext(cs.Build)
+		if err != nil {
+			return err
+		}
+		res.Builds[name] = context
+		if svc.Image == "" {
+			svc.Image = name
+			res.warnf("%s: built from %q, image set to %q, publish the built image and update the SDL", name, context, name)
+		}
+	}
+	if svc.Image == "" {
+		return errors.New("either image or build is required")
+	}
+
+	// command and entrypoint
+	var err error
+	if cs.Entrypoint.Kind == yaml.ScalarNode {
+		svc.Command = []string{"sh", "-c", cs.Entrypoint.Value}
+	} else if svc.Command, err = stringOrList(cs.Entrypoint); err != nil {
+		return errors.Wrap(err, "entrypoint")
+	}
+	switch {
+	case cs.Command.Kind == yaml.ScalarNode && len(svc.Command) == 0:
+		// shell form
+		svc.Command, svc.Args = []string{"sh", "-c"}, []string{cs.Command.Value}
+	case cs.Command.Kind == yaml.ScalarNode:
+		svc.Args = strings.Fields(cs.Command.Value)
+	default:
+		if svc.Args, err = stringOrList(cs.Command); err != nil {
+			return errors.Wrap(err, "command")
+		}
+	}
+
+	// environment, the env files are read first so that environment overrides them
+	env := map[string]string{}
+	files, err := stringOrList(cs.EnvFile)
+	if err != nil {
+		return errors.Wrap(err, "env_file")
+	}
+	for _, file := range files {
+		vars, err := envutil.ParseFile(filepath.Join(dir, file))
+		if err != nil {
+			return errors.Wrap(err, "env_file")
+		}
+		for k, v := range vars {
+			env[k] = v
+		}
+	}
+	vars, err := environment(res, name, cs.Environment)
+	if err != nil {
+		return errors.Wrap(err, "environment")
+	}
+	for k, v := range vars {
+		env[k] = v
+	}
+	for _, k := range sortedKeys(env) {
+		svc.Env = append(svc.Env, k+"="+env[k])
+	}
+
+	// ports, they are also exposed to the dependents
+	var to []ExposeTo
+	for _, d := range dependents {
+		to = append(to, ExposeTo{Service: d})
+	}
+	for _, p := range cs.Ports {
+		expose, err := port(res, name, p)
+		if err != nil {
+			return errors.Wrap(err, "ports")
+		}
+		if expose != nil {
+			res.warnf("%s: published port %d is exposed to the internet, use expose for the ports that only other services use", name, expose.As)
+			expose.To = append(expose.To, to...)
+			svc.Expose = append(svc.Expose, *expose)
+		}
+	}
+	// without dependents, the exposed ports are exposed to every other service
+	if len(to) == 0 {
+		for _, other := range sortedKeys(f.Services) {
+			if other != name {
+				to = append(to, ExposeTo{Service: other})
+			}
+		}
+	}
+	for _, p := range cs.Expose {
+		target, err := strconv.Atoi(strings.SplitN(p.Value, "/", 2)[0])
+		if err != nil {
+			res.warnf("%s: expose %q is not supported and was ignored", name, p.Value)
+			continue
+		}
+		if len(to) == 0 {
+			res.warnf("%s: expose %q was ignored, there is no other service to expose it to", name, p.Value)
+			continue
+		}
+		svc.Expose = append(svc.Expose, Expose{Port: target, As: target, To: to})
+	}
+
+	// resources
+	resources := Resources{
+		CPU:     CPU{Units: DefaultCPU},
+		Memory:  Size{Size: DefaultMemory},
+		Storage: []Storage{{Size: DefaultStorage}},
+	}
+	limits := cs.Deploy.Resources.Limits
+	if limits.CPUs != "" {
+		cpu, err := strconv.ParseFloat(limits.CPUs, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid cpus limit %q", limits.CPUs)
+		}
+		resources.CPU.Units = cpu
+	}
+	if limits.Memory != "" {
+		mem, err := convertSize(limits.Memory)
+		if err != nil {
+			return errors.Wrap(err, "memory limit")
+		}
+		resources.Memory.Size = mem
+	}
+
+	// volumes
+	for _, v := range cs.Volumes {
+		vol, err := volume(res, f, name, v)
+		if err != nil {
+			return errors.Wrap(err, "volumes")
+		}
+		if vol == nil {
+			continue
+		}
+		if svc.Params == nil {
+			svc.Params = &Params{Storage: map[string]StorageParams{}}
+		}
+		svc.Params.Storage[vol.name] = StorageParams{Mount: vol.mount, ReadOnly: vol.readOnly}
+		resources.Storage = append(resources.Storage, Storage{
+			Name:       vol.name,
+			Size:       DefaultStorage,
+			Attributes: &StorageAttributes{Persistent: true, Class: "beta2"},
+		})
+	}
+
+	count := 1
+	if cs.Deploy.Replicas != nil {
+		count = *cs.Deploy.Replicas
+	}
+
+	for _, key := range sortedKeys(cs.Extra) {
+		res.warnf("%s: %q is not supported and was ignored", name, key)
+	}
+
+	res.SDL.Services[name] = svc
+	res.SDL.Profiles.Compute[name] = ComputeProfile{Resources: resources}
+	res.SDL.Profiles.Placement[DefaultPlacement].Pricing[name] = Price{Denom: "uakt", Amount: DefaultPrice}
+	res.SDL.Deployment[name] = map[string]DeploymentTarget{DefaultPlacement: {Profile: name, Count: count}}
+	return nil
+}
+
+func buildContext(n yaml.Node) (string, error) {
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, nil
+	}
+	var build struct {
+		Context string `yaml:"context"`
+	}
+	if err := n.Decode(&build); err != nil {
+		return "", errors.Wrap(err, "build")
+	}
+	if build.Context == "" {
+		return ".", nil
+	}
+	return build.Context, nil
+}
+
+// port translates a compose port into an SDL expose. Short syntax is of the form
+// [HOST:]CONTAINER[/PROTOCOL] where HOST can be prefixed with an IP address.
+func port(res *Result, service string, n yaml.Node) (*Expose, error) {
+	var target, published, proto string
+	switch n.Kind {
+	case yaml.ScalarNode:
+		spec := n.Value
+		if i := strings.Index(spec, "/"); i >= 0 {
+			spec, proto = spec[:i], spec[i+1:]
+		}
+		parts := strings.Split(spec, ":")
+		switch len(parts) {
+		case 1:
+			target = parts[0]
+		case 2:
+			published, target = parts[0], parts[1]
+		case 3:
+			res.warnf("%s: host IP %q of port %q is not supported and was dropped", service, parts[0], n.Value)
+			published, target = parts[1], parts[2]
+		default:
+			return nil, errors.Errorf("invalid port %q", n.Value)
+		}
+	case yaml.MappingNode:
+		var long struct {
+			Target    string `yaml:"target"`
+			Published string `yaml:"published"`
+			Protocol  string `yaml:"protocol"`
+		}
+		if err := n.Decode(&long); err != nil {
+			return nil, err
+		}
+		target, published, proto = long.Target, long.Published, long.Protocol
+	default:
+		return nil, errors.New("invalid port")
+	}
+
+	if strings.Contains(target, "-") || strings.Contains(published, "-") {
+		res.warnf("%s: port range %q is not supported and was ignored", service, n.Value)
+		return nil, nil
+	}
+	t, err := strconv.Atoi(target)
+	if err != nil {
+		return nil, errors.Errorf("invalid port %q", n.Value)
+	}
+	expose := &Expose{Port: t, As: t, To: []ExposeTo{{Global: true}}}
+	if published != "" {
+		if expose.As, err = strconv.Atoi(published); err != nil {
+			return nil, errors.Errorf("invalid port %q", n.Value)
+		}
+	}
+	if proto != "" && proto != "tcp" {
+		expose.Proto = proto
+	}
+	return expose, nil
+}
+
+type volumeMount struct {
+	name     string
+	mount    string
+	readOnly bool
+}
+
+// volume translates a named compose volume into persistent storage. Bind mounts and
+// anonymous volumes have no equivalent on Akash.
+func volume(res *Result, f *File, service string, n yaml.Node) (*volumeMount, error) {
+	var source, target, typ string
+	var readOnly bool
+	switch n.Kind {
+	case yaml.ScalarNode:
+		parts := strings.Split(n.Value, ":")
+		switch len(parts) {
+		case 1:
+			target = parts[0]
+		case 2, 3:
+			source, target = parts[0], parts[1]
+			readOnly = len(parts) == 3 && strings.Contains(parts[2], "ro")
+		default:
+			return nil, errors.Errorf("invalid volume %q", n.Value)
+		}
+	case yaml.MappingNode:
+		var long struct {
+			Type     string `yaml:"type"`
+			Source   string `yaml:"source"`
+			Target   string `yaml:"target"`
+			ReadOnly bool   `yaml:"read_only"`
+		}
+		if err := n.Decode(&long); err != nil {
+			return nil, err
+		}
+		typ, source, target, readOnly = long.Type, long.Source, long.Target, long.ReadOnly
+	default:
+		return nil, errors.New("invalid volume")
+	}
+
+	switch {
+	case typ != "" && typ != "volume":
+		res.warnf("%s: %s mount of %q is not supported and was ignored", service, typ, target)
+		return nil, nil
+	case source == "":
+		res.warnf("%s: anonymous volume %q is not supported and was ignored", service, target)
+		return nil, nil
+	case strings.HasPrefix(source, ".") || strings.HasPrefix(source, "/") || strings.HasPrefix(source, "~"):
+		res.warnf("%s: bind mount %q is not supported and was ignored, bake the files into the image instead", service, source)
+		return nil, nil
+	}
+	if _, ok := f.Volumes[source]; !ok {
+		res.warnf("%s: volume %q is not declared in the top-level volumes", service, source)
+	}
+	return &volumeMount{name: source, mount: target, readOnly: readOnly}, nil
+}
+
+// convertSize converts a compose byte size (512m, 1gb, 1024k) into an SDL size (512Mi, 1Gi, 1024Ki)
+func convertSize(s string) (string, error) {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	for _, u := range []struct{ suffix, unit string }{
+		{"kb", "Ki"}, {"mb", "Mi"}, {"gb", "Gi"}, {"tb", "Ti"},
+		{"k", "Ki"}, {"m", "Mi"}, {"g", "Gi"}, {"t", "Ti"}, {"b", ""},
+	} {
+		if strings.HasSuffix(lower, u.suffix) {
+			num := strings.TrimSuffix(lower, u.suffix)
+			if _, err := strconv.ParseFloat(num, 64); err != nil {
+				return "", errors.Errorf("invalid size %q", s)
+			}
+			return num + u.unit, nil
+		}
+	}
+	if _, err := strconv.ParseUint(lower, 10, 64); err != nil {
+		return "", errors.Errorf("invalid size %q", s)
+	}
+	return lower, nil
+}
+
+// environment reads the compose environment in either the map or the list form. As with compose,
+// the variables without a value take the value of the environment of eve, and are dropped when it
+// does not set them.
+func environment(res *Result, service string, n yaml.Node) (map[string]string, error) {
+	env := map[string]string{}
+	lookup := func(k string) {
+		if v, ok := os.LookupEnv(k); ok {
+			env[k] = v
+			return
+		}
+		res.warnf("%s: %s has no value and is not set in the environment, it was dropped", service, k)
+	}
+	switch n.Kind {
+	case 0:
+	case yaml.MappingNode:
+		var m map[string]*string
+		if err := n.Decode(&m); err != nil {
+			return nil, err
+		}
+		for _, k := range sortedKeys(m) {
+			if m[k] == nil {
+				lookup(k)
+				continue
+			}
+			env[k] = *m[k]
+		}
+	case yaml.SequenceNode:
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			arr := strings.SplitN(item, "=", 2)
+			if len(arr) > 1 {
+				env[arr[0]] = arr[1]
+			} else {
+				lookup(arr[0])
+			}
+		}
+	default:
+		return nil, errors.New("expected a map or a list")
+	}
+	return env, nil
+}
+
+// stringOrList decodes a node that is either a single string or a list of strings
+func stringOrList(n yaml.Node) ([]string, error) {
+	switch n.Kind {
+	case 0:
+		return nil, nil
+	case yaml.ScalarNode:
+		return []string{n.Value}, nil
+	}
+	var list []string
+	if err := n.Decode(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,227 @@
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCompose = `
+version: "3.8"
+services:
+  web:
+    build: ./web
+    command: npm start
+    env_file: web.env
+    environment:
+      NODE_ENV: production
+    ports:
+      - "8080:3000"
+      - "127.0.0.1:9000:9000/udp"
+    volumes:
+      - data:/var/lib/data:ro
+      - ./src:/app/src
+    deploy:
+      replicas: 3
+      resources:
+        limits:
+          cpus: "1.5"
+          memory: 1g
+    depends_on:
+      - db
+  db:
+    image: postgres:14
+    environment:
+      - POSTGRES_PASSWORD=secret
+    expose:
+      - "5432"
+volumes:
+  data:
+networks:
+  backend:
+`
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "web.env"), []byte("# comment\nNODE_ENV=dev\nPORT=3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Convert([]byte(testCompose), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := res.SDL.Services["web"]
+	if web.Image != "web" {
+		t.Errorf("expected the image of the built service to be %q, got %q", "web", web.Image)
+	}
+	if got := res.Builds["web"]; got != "./web" {
+		t.Errorf("expected build context ./web, got %q", got)
+	}
+	if expect := []string{"sh", "-c"}; !reflect.DeepEqual(web.Command, expect) {
+		t.Errorf("expected command %v, got %v", expect, web.Command)
+	}
+	if expect := []string{"NODE_ENV=production", "PORT=3000"}; !reflect.DeepEqual(web.Env, expect) {
+		t.Errorf("expected env %v, got %v", expect, web.Env)
+	}
+	expectExpose := []Expose{
+		{Port: 3000, As: 8080, To: []ExposeTo{{Global: true}}},
+		{Port: 9000, As: 9000, Proto: "udp", To: []ExposeTo{{Global: true}}},
+	}
+	if !reflect.DeepEqual(web.Expose, expectExpose) {
+		t.Errorf("expected expose %+v, got %+v", expectExpose, web.Expose)
+	}
+	if got := web.Params.Storage["data"]; got.Mount != "/var/lib/data" || !got.ReadOnly {
+		t.Errorf("unexpected storage params %+v", got)
+	}
+
+	resources := res.SDL.Profiles.Compute["web"].Resources
+	if resources.CPU.Units != 1.5 || resources.Memory.Size != "1Gi" {
+		t.Errorf("unexpected resources %+v", resources)
+	}
+	if len(resources.Storage) != 2 || !resources.Storage[1].Attributes.Persistent {
+		t.Errorf("expected a persistent storage, got %+v", resources.Storage)
+	}
+	if got := res.SDL.Deployment["web"][DefaultPlacement].Count; got != 3 {
+		t.Errorf("expected count 3, got %d", got)
+	}
+
+	db := res.SDL.Services["db"]
+	if expect := []Expose{{Port: 5432, As: 5432, To: []ExposeTo{{Service: "web"}}}}; !reflect.DeepEqual(db.Expose, expect) {
+		t.Errorf("expected expose %+v, got %+v", expect, db.Expose)
+	}
+
+	warnings := strings.Join(res.Warnings, "\n")
+	for _, expect := range []string{"networks", "host IP", "bind mount", "depends_on"} {
+		if !strings.Contains(warnings, expect) {
+			t.Errorf("expected a warning about %s, got:\n%s", expect, warnings)
+		}
+	}
+}
+
+func TestConvert_Expose(t *testing.T) {
+	res, err := Convert([]byte(`
+services:
+  api:
+    image: api
+    links:
+      - cache:redis
+  web:
+    image: web
+    depends_on:
+      cache:
+        condition: service_started
+  cache:
+    image: redis
+    expose:
+      - "6379"
+  db:
+    image: postgres
+    expose:
+      - "5432"
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][]ExposeTo{
+		"cache": {{Service: "api"}, {Service: "web"}},
+		"db":    {{Service: "api"}, {Service: "cache"}, {Service: "web"}},
+	}
+	for name, expect := range cases {
+		if got := res.SDL.Services[name].Expose[0].To; !reflect.DeepEqual(got, expect) {
+			t.Errorf("%s: expected to expose to %+v, got %+v", name, expect, got)
+		}
+	}
+	if warnings := strings.Join(res.Warnings, "\n"); !strings.Contains(warnings, `alias "redis"`) {
+		t.Errorf("expected a warning about the link alias, got:\n%s", warnings)
+	}
+
+	if _, err := Convert([]byte("services:\n  web:\n    image: web\n    depends_on: [db]\n"), ""); err == nil {
+		t.Error("expected an error for a dependency on an undefined service")
+	}
+}
+
+func TestConvert_PortsDependents(t *testing.T) {
+	res, err := Convert([]byte(`
+services:
+  web:
+    image: web
+    ports:
+      - "80:3000"
+    depends_on: [db]
+  db:
+    image: postgres
+    ports:
+      - "5432:5432"
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Expose{{Port: 5432, As: 5432, To: []ExposeTo{{Global: true}, {Service: "web"}}}}
+	if got := res.SDL.Services["db"].Expose; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected db to expose %+v, got %+v", expect, got)
+	}
+	expect = []Expose{{Port: 3000, As: 80, To: []ExposeTo{{Global: true}}}}
+	if got := res.SDL.Services["web"].Expose; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected web to expose %+v, got %+v", expect, got)
+	}
+	if warnings := strings.Join(res.Warnings, "\n"); !strings.Contains(warnings, "db: published port 5432 is exposed to the internet") {
+		t.Errorf("expected a warning about the global port of db, got:\n%s", warnings)
+	}
+}
+
+func TestConvert_EnvironmentLookup(t *testing.T) {
+	t.Setenv("EVE_COMPOSE_SET", "from-env")
+	res, err := Convert([]byte(`
+services:
+  web:
+    image: web
+    environment:
+      - EVE_COMPOSE_SET
+      - EVE_COMPOSE_UNSET
+      - EMPTY=
+  db:
+    image: postgres
+    environment:
+      EVE_COMPOSE_SET:
+      EVE_COMPOSE_UNSET:
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"EMPTY=", "EVE_COMPOSE_SET=from-env"}; !reflect.DeepEqual(res.SDL.Services["web"].Env, expect) {
+		t.Errorf("expected env %v, got %v", expect, res.SDL.Services["web"].Env)
+	}
+	if expect := []string{"EVE_COMPOSE_SET=from-env"}; !reflect.DeepEqual(res.SDL.Services["db"].Env, expect) {
+		t.Errorf("expected env %v, got %v", expect, res.SDL.Services["db"].Env)
+	}
+	warnings := strings.Join(res.Warnings, "\n")
+	if strings.Count(warnings, "EVE_COMPOSE_UNSET has no value") != 2 {
+		t.Errorf("expected a warning about EVE_COMPOSE_UNSET for each service, got:\n%s", warnings)
+	}
+}
+
+func TestConvertSize(t *testing.T) {
+	cases := map[string]string{
+		"512m":  "512Mi",
+		"1GB":   "1Gi",
+		"100k":  "100Ki",
+		"1024":  "1024",
+		"2048b": "2048",
+	}
+	for in, expect := range cases {
+		got, err := convertSize(in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if got != expect {
+			t.Errorf("%s: expected %s, got %s", in, expect, got)
+		}
+	}
+	if _, err := convertSize("lots"); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
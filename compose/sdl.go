@@ -0,0 +1,140 @@
+package compose
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPlacement is the name of the placement profile of the generated SDL
+const DefaultPlacement = "akash"
+
+// SDL is an Akash SDL document. The fields are declared in the order they are written.
+type SDL struct {
+	Version    string                                 `yaml:"version"`
+	Services   map[string]*SDLService                 `yaml:"services"`
+	Profiles   Profiles                               `yaml:"profiles"`
+	Deployment map[string]map[string]DeploymentTarget `yaml:"deployment"`
+}
+
+// NewSDL returns an empty SDL with the default placement
+func NewSDL() *SDL {
+	return &SDL{
+		Version:  "2.0",
+		Services: map[string]*SDLService{},
+		Profiles: Profiles{
+			Compute: map[string]ComputeProfile{},
+			Placement: map[string]Placement{
+				DefaultPlacement: {Pricing: map[string]Price{}},
+			},
+		},
+		Deployment: map[string]map[string]DeploymentTarget{},
+	}
+}
+
+// Marshal returns the YAML encoding of the SDL indented with two spaces
+func (s *SDL) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SDLService is a service in the SDL
+type SDLService struct {
+	Image   string   `yaml:"image"`
+	Command []string `yaml:"command,omitempty"`
+	Args    []string `yaml:"args,omitempty"`
+	Env     []string `yaml:"env,omitempty"`
+	Expose  []Expose `yaml:"expose,omitempty"`
+	Params  *Params  `yaml:"params,omitempty"`
+}
+
+// Expose is a port exposed by a service
+type Expose struct {
+	Port  int        `yaml:"port"`
+	As    int        `yaml:"as,omitempty"`
+	Proto string     `yaml:"proto,omitempty"`
+	To    []ExposeTo `yaml:"to,omitempty"`
+}
+
+// ExposeTo is the destination of an exposed port
+type ExposeTo struct {
+	Service string `yaml:"service,omitempty"`
+	Global  bool   `yaml:"global,omitempty"`
+}
+
+// Params holds the service parameters
+type Params struct {
+	Storage map[string]StorageParams `yaml:"storage,omitempty"`
+}
+
+// StorageParams defines where a storage volume is mounted
+type StorageParams struct {
+	Mount    string `yaml:"mount"`
+	ReadOnly bool   `yaml:"readOnly,omitempty"`
+}
+
+// Profiles holds the compute and placement profiles
+type Profiles struct {
+	Compute   map[string]ComputeProfile `yaml:"compute"`
+	Placement map[string]Placement      `yaml:"placement"`
+}
+
+// ComputeProfile is the compute profile of a service
+type ComputeProfile struct {
+	Resources Resources `yaml:"resources"`
+}
+
+// Resources are the resources requested by a service
+type Resources struct {
+	CPU     CPU       `yaml:"cpu"`
+	Memory  Size      `yaml:"memory"`
+	Storage []Storage `yaml:"storage"`
+}
+
+// CPU is the number of CPU units
+type CPU struct {
+	Units float64 `yaml:"units"`
+}
+
+// Size is a quantity such as 512Mi
+type Size struct {
+	Size string `yaml:"size"`
+}
+
+// Storage is a storage volume, the unnamed one being the ephemeral root storage
+type Storage struct {
+	Name       string             `yaml:"name,omitempty"`
+	Size       string             `yaml:"size"`
+	Attributes *StorageAttributes `yaml:"attributes,omitempty"`
+}
+
+// StorageAttributes are the attributes of a persistent volume
+type StorageAttributes struct {
+	Persistent bool   `yaml:"persistent"`
+	Class      string `yaml:"class"`
+}
+
+// Placement is a placement profile
+type Placement struct {
+	Pricing map[string]Price `yaml:"pricing"`
+}
+
+// Price is the maximum price for a service
+type Price struct {
+	Denom  string `yaml:"denom"`
+	Amount int    `yaml:"amount"`
+}
+
+// DeploymentTarget maps a service to its profile and count in a placement
+type DeploymentTarget struct {
+	Profile string `yaml:"profile"`
+	Count   int    `yaml:"count"`
+}
@@ -0,0 +1,161 @@
+// Package lease decodes the status of Akash leases from the JSON output of the akash CLI
+package lease
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Status is the status of a lease reported by its provider, the output of akash provider lease-status
+type Status struct {
+	Services       map[string]*ServiceStatus  `json:"services"`
+	ForwardedPorts map[string][]ForwardedPort `json:"forwarded_ports"`
+	IPs            map[string][]LeasedIP      `json:"ips"`
+}
+
+// ServiceStatus is the status of the replicas of a service
+type ServiceStatus struct {
+	Name              string   `json:"name"`
+	Available         int32    `json:"available"`
+	Total             int32    `json:"total"`
+	URIs              []string `json:"uris"`
+	ReadyReplicas     int32    `json:"ready_replicas"`
+	AvailableReplicas int32    `json:"available_replicas"`
+}
+
+// ForwardedPort is a port of a service forwarded from a port of the provider host
+type ForwardedPort struct {
+	Host         string `json:"host"`
+	Port         uint16 `json:"port"`
+	ExternalPort uint16 `json:"externalPort"`
+	Proto        string `json:"proto"`
+	Name         string `json:"name"`
+}
+
+// LeasedIP is a port of a service exposed on a leased IP
+type LeasedIP struct {
+	IP           string `json:"IP"`
+	Port         uint32 `json:"Port"`
+	ExternalPort uint32 `json:"ExternalPort"`
+	Protocol     string `json:"Protocol"`
+}
+
+// Coin is an amount of a denomination, such as the price of a lease
+type Coin struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+// Lease is a lease on chain with its escrow payment, an entry of akash query market lease list
+type Lease struct {
+	Lease struct {
+		State string `json:"state"`
+		Price Coin   `json:"price"`
+	} `json:"lease"`
+	EscrowPayment struct {
+		State   string `json:"state"`
+		Balance Coin   `json:"balance"`
+	} `json:"escrow_payment"`
+}
+
+// Deployment is a deployment on chain with its escrow account, the output of akash query deployment get
+type Deployment struct {
+	EscrowAccount struct {
+		State   string `json:"state"`
+		Balance Coin   `json:"balance"`
+	} `json:"escrow_account"`
+}
+
+// Provider is a provider on chain, the output of akash query provider get
+type Provider struct {
+	Owner   string `json:"owner"`
+	HostURI string `json:"host_uri"`
+}
+
+// DecodeStatus decodes the output of akash provider lease-status
+func DecodeStatus(b []byte) (*Status, error) {
+	s := &Status{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the lease status")
+	}
+	for name, svc := range s.Services {
+		if svc == nil {
+			delete(s.Services, name)
+			continue
+		}
+		if svc.Name == "" {
+			svc.Name = name
+		}
+	}
+	return s, nil
+}
+
+// DecodeLeases decodes the output of akash query market lease list
+func DecodeLeases(b []byte) ([]*Lease, error) {
+	var out struct {
+		Leases []*Lease `json:"leases"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the leases")
+	}
+	return out.Leases, nil
+}
+
+// DecodeDeployment decodes the output of akash query deployment get
+func DecodeDeployment(b []byte) (*Deployment, error) {
+	d := &Deployment{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the deployment")
+	}
+	return d, nil
+}
+
+// DecodeProvider decodes the output of akash query provider get
+func DecodeProvider(b []byte) (*Provider, error) {
+	p := &Provider{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the provider")
+	}
+	return p, nil
+}
+
+// ServiceNames returns the names of the services in order
+func (s *Status) ServiceNames() []string {
+	names := make([]string, 0, len(s.Services))
+	for name := range s.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Ready returns the ready and the total replicas of the service, such as 1/2
+func (s *ServiceStatus) Ready() string {
+	return fmt.Sprintf("%d/%d", s.ReadyReplicas, s.Total)
+}
+
+// String returns the port as host:externalPort->port/proto
+func (p ForwardedPort) String() string {
+	return fmt.Sprintf("%s:%d->%d/%s", p.Host, p.ExternalPort, p.Port, p.Proto)
+}
+
+// String returns the leased IP as ip:externalPort->port/protocol
+func (ip LeasedIP) String() string {
+	return fmt.Sprintf("%s:%d->%d/%s", ip.IP, ip.ExternalPort, ip.Port, ip.Protocol)
+}
+
+// String returns the amount without trailing decimal zeros and the denomination, such as 10.5 uakt
+func (c Coin) String() string {
+	if c.Amount == "" {
+		return "-"
+	}
+	amount := c.Amount
+	if strings.Contains(amount, ".") {
+		amount = strings.TrimRight(strings.TrimRight(amount, "0"), ".")
+	}
+	return amount + " " + c.Denom
+}
@@ -0,0 +1,74 @@
+package lease
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const statusJSON = `{
+  "services": {
+    "web": {"name": "web", "available": 1, "total": 2, "uris": ["abc.ingress.provider.com"], "observed_generation": 1, "replicas": 2, "updated_replicas": 2, "ready_replicas": 1, "available_replicas": 1},
+    "db": {"name": "", "available": 1, "total": 1, "uris": null, "ready_replicas": 1},
+    "gone": null
+  },
+  "forwarded_ports": {
+    "db": [{"host": "provider.com", "port": 5432, "externalPort": 31522, "proto": "TCP", "available": 1, "name": "db"}]
+  },
+  "ips": {
+    "web": [{"IP": "203.0.113.7", "Port": 443, "ExternalPort": 443, "Protocol": "TCP"}]
+  }
+}`
+
+func TestDecodeStatus(t *testing.T) {
+	s, err := DecodeStatus([]byte(statusJSON))
+	require.NoError(t, err)
+	require.Equal(t, []string{"db", "web"}, s.ServiceNames())
+	require.Equal(t, "db", s.Services["db"].Name)
+	require.Equal(t, "1/2", s.Services["web"].Ready())
+	require.Equal(t, []string{"abc.ingress.provider.com"}, s.Services["web"].URIs)
+	require.Equal(t, "provider.com:31522->5432/TCP", s.ForwardedPorts["db"][0].String())
+	require.Equal(t, "203.0.113.7:443->443/TCP", s.IPs["web"][0].String())
+
+	// unexpected types are errors instead of panics
+	_, err = DecodeStatus([]byte(`{"services": {"web": "running"}}`))
+	require.Error(t, err)
+	_, err = DecodeStatus([]byte(`{"services": []}`))
+	require.Error(t, err)
+}
+
+func TestDecodeLeases(t *testing.T) {
+	leases, err := DecodeLeases([]byte(`{"leases": [{
+  "lease": {"lease_id": {"owner": "akash1owner", "dseq": "42"}, "state": "active", "price": {"denom": "uakt", "amount": "12.500000000000000000"}},
+  "escrow_payment": {"state": "open", "rate": {"denom": "uakt", "amount": "12.5"}, "balance": {"denom": "uakt", "amount": "0.000000000000000000"}}
+}], "pagination": {}}`))
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	require.Equal(t, "active", leases[0].Lease.State)
+	require.Equal(t, "12.5 uakt", leases[0].Lease.Price.String())
+	require.Equal(t, "0 uakt", leases[0].EscrowPayment.Balance.String())
+}
+
+func TestDecodeDeploymentProvider(t *testing.T) {
+	d, err := DecodeDeployment([]byte(`{"deployment": {}, "escrow_account": {"state": "open", "balance": {"denom": "uakt", "amount": "4999990.000000000000000000"}}}`))
+	require.NoError(t, err)
+	require.Equal(t, "4999990 uakt", d.EscrowAccount.Balance.String())
+
+	p, err := DecodeProvider([]byte(`{"owner": "akash1provider", "host_uri": "https://provider.example.com:8443", "attributes": []}`))
+	require.NoError(t, err)
+	require.Equal(t, "https://provider.example.com:8443", p.HostURI)
+}
+
+func TestCoin_String(t *testing.T) {
+	for _, tc := range []struct {
+		coin   Coin
+		expect string
+	}{
+		{Coin{"uakt", "100"}, "100 uakt"},
+		{Coin{"uakt", "100.000"}, "100 uakt"},
+		{Coin{"uakt", "0.0500"}, "0.05 uakt"},
+		{Coin{}, "-"},
+	} {
+		require.Equal(t, tc.expect, tc.coin.String())
+	}
+}
@@ -7,12 +7,25 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/alecthomas/chroma/quick"
 	"github.com/logrusorgru/aurora"
 )
 
-var defaultLogger *Logger
+var (
+	defaultLogger *Logger
+
+	masksMu sync.RWMutex
+	masks   []string
+)
+
+// maskReplacement is the text that masked values are replaced with.
+const maskReplacement = "****"
+
+// minMaskLength is the length below which values are not masked, short values such as 1, true or 80
+// would be replaced in unrelated output such as DSEQs, digests and ports.
+const minMaskLength = 4
 
 // Level is the level of logging.
 type Level int
@@ -66,6 +79,29 @@ func Errorf(format string, v ...interface{}) {
 	defaultLogger.Errorf(format, v...)
 }
 
+// Mask registers sensitive values that must never appear in the log output.
+// Every occurrence of a masked value is replaced with "****", values shorter than
+// minMaskLength are not masked.
+func Mask(values ...string) {
+	masksMu.Lock()
+	defer masksMu.Unlock()
+	for _, v := range values {
+		if len(v) >= minMaskLength {
+			masks = append(masks, v)
+		}
+	}
+}
+
+// Redact replaces all the masked values in the given string.
+func Redact(s string) string {
+	masksMu.RLock()
+	defer masksMu.RUnlock()
+	for _, m := range masks {
+		s = strings.ReplaceAll(s, m, maskReplacement)
+	}
+	return s
+}
+
 // FromEnv creates a logger from the environment variable LOG_LEVEL.
 func FromEnv(out io.Writer) *Logger {
 	return &Logger{
@@ -93,7 +129,9 @@ func levelFromEnv() Level {
 }
 
 func (l *Logger) debug(v ...interface{}) {
+	msg := Redact(fmt.Sprint(v...))
 	if str, ok := v[0].(string); ok {
+		str = Redact(str)
 		byteString := []byte(str)
 		if json.Valid(byteString) {
 			var prettyJSON bytes.Buffer
@@ -103,7 +141,7 @@ func (l *Logger) debug(v ...interface{}) {
 			}
 		}
 	}
-	fmt.Fprintln(l.out, aurora.Faint("DEBUG"), fmt.Sprint(v...))
+	fmt.Fprintln(l.out, aurora.Faint("DEBUG"), msg)
 }
 
 func (l *Logger) Debug(v ...interface{}) {
@@ -119,7 +157,7 @@ func (l *Logger) Debugf(format string, v ...interface{}) {
 }
 
 func (l *Logger) info(v ...interface{}) {
-	fmt.Fprintln(l.out, aurora.Faint("INFO"), fmt.Sprint(v...))
+	fmt.Fprintln(l.out, aurora.Faint("INFO"), Redact(fmt.Sprint(v...)))
 }
 
 func (l *Logger) Info(v ...interface{}) {
@@ -135,7 +173,7 @@ func (l *Logger) Infof(format string, v ...interface{}) {
 }
 
 func (l *Logger) warn(v ...interface{}) {
-	fmt.Fprintln(l.out, aurora.Yellow("WARN"), fmt.Sprint(v...))
+	fmt.Fprintln(l.out, aurora.Yellow("WARN"), Redact(fmt.Sprint(v...)))
 }
 
 func (l *Logger) Warn(v ...interface{}) {
@@ -151,7 +189,7 @@ func (l *Logger) Warnf(format string, v ...interface{}) {
 }
 
 func (l *Logger) error(v ...interface{}) {
-	fmt.Fprintln(l.out, aurora.Red("ERROR"), fmt.Sprint(v...))
+	fmt.Fprintln(l.out, aurora.Red("ERROR"), Redact(fmt.Sprint(v...)))
 }
 
 func (l *Logger) Error(v ...interface{}) {
@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/pkg/errors"
+)
+
+const (
+	// RefNameAnnotation is the OCI annotation of the reference of an image in an archive
+	RefNameAnnotation = "org.opencontainers.image.ref.name"
+	// ServiceAnnotation is the annotation of the service of an image in an archive
+	ServiceAnnotation = "dev.eve.service"
+)
+
+// ArchiveImage is an image of an archive
+type ArchiveImage struct {
+	// Service is the name of the service of the image
+	Service string
+	// Ref is the reference of the image, such as ghcr.io/acme/web:1.0.0
+	Ref   string
+	Image v1.Image
+}
+
+// Archive is an OCI layout tarball with the images and files that are not part of the layout
+type Archive struct {
+	Images []*ArchiveImage
+	// Files are the other files of the tarball by path
+	Files map[string][]byte
+
+	dir string
+}
+
+// WriteArchive writes the images and the files to the tarball at p as an OCI image layout. The files
+// are stored next to the layout, their paths must not collide with it.
+func WriteArchive(p string, images []*ArchiveImage, files map[string][]byte) error {
+	dir, err := os.MkdirTemp("", "eve-archive-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the image layout")
+	}
+	for _, img := range images {
+		err := l.AppendImage(img.Image, layout.WithAnnotations(map[string]string{
+			RefNameAnnotation: img.Ref,
+			ServiceAnnotation: img.Service,
+		}))
+		if err != nil {
+			return errors.Wrapf(err, "failed to write %s to the image layout", img.Ref)
+		}
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", p)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		return writeTarFile(tw, filepath.ToSlash(rel), info.Size(), func(w io.Writer) error {
+			src, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			_, err = io.Copy(w, src)
+			return err
+		})
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to write the archive")
+	}
+	paths := make([]string, 0, len(files))
+	for file := range files {
+		paths = append(paths, file)
+	}
+	sort.Strings(paths)
+	for _, file := range paths {
+		b := files[file]
+		err := writeTarFile(tw, file, int64(len(b)), func(w io.Writer) error {
+			_, err := w.Write(b)
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to write the archive")
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, size int64, write func(w io.Writer) error) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	return write(tw)
+}
+
+// ReadArchive reads the images and the files of the tarball at p, written by WriteArchive. The
+// archive is extracted to a temporary directory until it is closed.
+func ReadArchive(p string) (*Archive, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", p)
+	}
+	defer f.Close()
+	dir, err := os.MkdirTemp("", "eve-archive-")
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{Files: map[string][]byte{}, dir: dir}
+	if err := a.extract(f); err != nil {
+		a.Close()
+		return nil, errors.Wrapf(err, "failed to read %s", p)
+	}
+
+	idx, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		a.Close()
+		return nil, errors.Wrapf(err, "%s is not an OCI image layout", p)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	for _, desc := range manifest.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			a.Close()
+			return nil, errors.Wrapf(err, "failed to read image %s", desc.Digest)
+		}
+		a.Images = append(a.Images, &ArchiveImage{
+			Service: desc.Annotations[ServiceAnnotation],
+			Ref:     desc.Annotations[RefNameAnnotation],
+			Image:   img,
+		})
+	}
+	return a, nil
+}
+
+// extract extracts the layout to the directory of the archive and reads the other files
+func (a *Archive) extract(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return errors.Errorf("invalid path %q", hdr.Name)
+		}
+		if !isLayoutFile(name) {
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			a.Files[name] = b
+			continue
+		}
+		target := filepath.Join(a.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		dst, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, tr)
+		dst.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close removes the extracted archive
+func (a *Archive) Close() error {
+	return os.RemoveAll(a.dir)
+}
+
+// isLayoutFile returns true for the files of an OCI image layout
+func isLayoutFile(name string) bool {
+	return name == "oci-layout" || name == "index.json" || strings.HasPrefix(name, "blobs/")
+}
+
+// Load writes the image to the local docker daemon as image and tags it with the other images
+func Load(ctx context.Context, img v1.Image, image string, others ...string) error {
+	tag, err := name.NewTag(image)
+	if err != nil {
+		return errors.Wrapf(err, "invalid image tag %q", image)
+	}
+	if _, err := daemon.Write(tag, img, daemon.WithContext(ctx)); err != nil {
+		return errors.Wrapf(err, "failed to load %s into the docker daemon", image)
+	}
+	for _, other := range others {
+		dst, err := name.NewTag(other)
+		if err != nil {
+			return errors.Wrapf(err, "invalid image tag %q", other)
+		}
+		if err := daemon.Tag(tag, dst, daemon.WithContext(ctx)); err != nil {
+			return errors.Wrapf(err, "failed to tag %s as %s", image, other)
+		}
+	}
+	return nil
+}
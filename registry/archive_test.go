@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	web, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	worker, err := random.Image(512, 1)
+	require.NoError(t, err)
+
+	p := filepath.Join(t.TempDir(), "out.tar")
+	files := map[string][]byte{"eve/metadata.json": []byte(`{"version":"1.0.0"}`)}
+	err = WriteArchive(p, []*ArchiveImage{
+		{Service: "web", Ref: "ghcr.io/acme/web:1.0.0", Image: web},
+		{Service: "worker", Ref: "ghcr.io/acme/worker:1.0.0", Image: worker},
+	}, files)
+	require.NoError(t, err)
+
+	a, err := ReadArchive(p)
+	require.NoError(t, err)
+	defer a.Close()
+	require.Equal(t, files, a.Files)
+	require.Len(t, a.Images, 2)
+	for i, want := range []struct {
+		service, ref string
+	}{{"web", "ghcr.io/acme/web:1.0.0"}, {"worker", "ghcr.io/acme/worker:1.0.0"}} {
+		require.Equal(t, want.service, a.Images[i].Service)
+		require.Equal(t, want.ref, a.Images[i].Ref)
+	}
+	wantDigest, err := web.Digest()
+	require.NoError(t, err)
+	gotDigest, err := a.Images[0].Image.Digest()
+	require.NoError(t, err)
+	require.Equal(t, wantDigest, gotDigest)
+
+	// the layers are read back from the archive
+	layers, err := a.Images[0].Image.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+	rc, err := layers[0].Compressed()
+	require.NoError(t, err)
+	rc.Close()
+}
+
+func TestArchive_InvalidPath(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "evil.tar")
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Size: 1, Typeflag: tar.TypeReg}))
+	_, err = tw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	_, err = ReadArchive(p)
+	require.Error(t, err)
+}
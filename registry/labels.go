@@ -0,0 +1,36 @@
+package registry
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/pkg/errors"
+)
+
+// WithLabels returns the image with the labels added to its config, and whether it had to be changed.
+// The image is returned as is when it already has the labels.
+func WithLabels(img v1.Image, labels map[string]string) (v1.Image, bool, error) {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to read the image config")
+	}
+	cfg := *cf.Config.DeepCopy()
+	changed := false
+	for k, v := range labels {
+		if cfg.Labels[k] == v {
+			continue
+		}
+		if cfg.Labels == nil {
+			cfg.Labels = map[string]string{}
+		}
+		cfg.Labels[k] = v
+		changed = true
+	}
+	if !changed {
+		return img, false, nil
+	}
+	labeled, err := mutate.Config(img, cfg)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to set the image labels")
+	}
+	return labeled, true, nil
+}
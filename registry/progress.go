@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"io"
+	"sync/atomic"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ProgressFunc receives the number of compressed bytes of the layer read by a push so far
+type ProgressFunc func(layer v1.Hash, read int64)
+
+// WithLayerProgress returns the image with layers that report to fn the bytes read from them. Layers
+// that are already in the registry are not read by a push.
+func WithLayerProgress(img v1.Image, fn ProgressFunc) v1.Image {
+	return &progressImage{Image: img, fn: fn}
+}
+
+type progressImage struct {
+	v1.Image
+	fn ProgressFunc
+}
+
+func (i *progressImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	wrapped := make([]v1.Layer, len(layers))
+	for n, l := range layers {
+		wrapped[n] = &progressLayer{Layer: l, fn: i.fn}
+	}
+	return wrapped, nil
+}
+
+func (i *progressImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	l, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return &progressLayer{Layer: l, fn: i.fn}, nil
+}
+
+type progressLayer struct {
+	v1.Layer
+	fn ProgressFunc
+}
+
+// Compressed counts the bytes read from each stream from zero, a retried upload starts over
+func (l *progressLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := l.Layer.Digest()
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	l.fn(digest, 0)
+	return &progressReader{ReadCloser: rc, digest: digest, fn: l.fn}, nil
+}
+
+type progressReader struct {
+	io.ReadCloser
+	digest v1.Hash
+	fn     ProgressFunc
+	read   int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.fn(r.digest, atomic.AddInt64(&r.read, int64(n)))
+	}
+	return n, err
+}
@@ -0,0 +1,234 @@
+// Package registry publishes images to OCI registries without the docker CLI
+package registry
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/pkg/errors"
+)
+
+// Options configures the registry client
+type Options struct {
+	// Keychain resolves the credentials of the registries, it defaults to the docker config
+	Keychain authn.Keychain
+	// Transport is the HTTP transport used to reach the registries, it defaults to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// Client pushes, tags and resolves images in OCI registries
+type Client struct {
+	keychain  authn.Keychain
+	transport http.RoundTripper
+}
+
+// New returns a client for the options. Credentials are read from the docker config
+// ($DOCKER_CONFIG/config.json or ~/.docker/config.json) and its credential helpers unless a
+// keychain is given.
+func New(opts Options) *Client {
+	c := &Client{keychain: opts.Keychain, transport: opts.Transport}
+	if c.keychain == nil {
+		c.keychain = authn.DefaultKeychain
+	}
+	if c.transport == nil {
+		c.transport = http.DefaultTransport
+	}
+	return c
+}
+
+func (c *Client) options(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(c.keychain),
+		remote.WithTransport(c.transport),
+	}
+}
+
+// Digest returns the digest of the image in the registry
+func (c *Client) Digest(ctx context.Context, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	desc, err := remote.Head(ref, c.options(ctx)...)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read the digest of %s", image)
+	}
+	return desc.Digest.String(), nil
+}
+
+// Exists returns true if the image is in the registry
+func (c *Client) Exists(ctx context.Context, image string) (bool, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	if _, err := remote.Head(ref, c.options(ctx)...); err != nil {
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to look up %s", image)
+	}
+	return true, nil
+}
+
+// Push uploads the image to the registry under the reference and returns its digest
+func (c *Client) Push(ctx context.Context, img v1.Image, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	if err := remote.Write(ref, img, c.options(ctx)...); err != nil {
+		return "", errors.Wrapf(err, "failed to push %s", image)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to compute the digest of %s", image)
+	}
+	return digest.String(), nil
+}
+
+// Image returns the image in the registry, its layers are fetched when they are read
+func (c *Client) Image(ctx context.Context, image string) (v1.Image, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	img, err := remote.Image(ref, c.options(ctx)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", image)
+	}
+	return img, nil
+}
+
+// Tag adds the tag to the image in the registry without downloading its layers, and returns the
+// digest of the tagged image
+func (c *Client) Tag(ctx context.Context, image, tag string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	desc, err := remote.Get(ref, c.options(ctx)...)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s", image)
+	}
+	dst := ref.Context().Tag(tag)
+	if err := remote.Tag(dst, desc, c.options(ctx)...); err != nil {
+		return "", errors.Wrapf(err, "failed to tag %s as %s", image, dst)
+	}
+	return desc.Digest.String(), nil
+}
+
+// Copy copies the image, or the index of a multi-platform image, to another repository, which may be
+// in another registry, and returns its digest
+func (c *Client) Copy(ctx context.Context, src, dst string) (string, error) {
+	srcRef, err := name.ParseReference(src)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", src)
+	}
+	dstRef, err := name.ParseReference(dst)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", dst)
+	}
+	desc, err := remote.Get(srcRef, c.options(ctx)...)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s", src)
+	}
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read the index of %s", src)
+		}
+		if err := remote.WriteIndex(dstRef, idx, c.options(ctx)...); err != nil {
+			return "", errors.Wrapf(err, "failed to copy %s to %s", src, dst)
+		}
+		return desc.Digest.String(), nil
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read the image of %s", src)
+	}
+	if err := remote.Write(dstRef, img, c.options(ctx)...); err != nil {
+		return "", errors.Wrapf(err, "failed to copy %s to %s", src, dst)
+	}
+	return desc.Digest.String(), nil
+}
+
+// Tags returns the tags of the repository, an image reference without tag or digest
+func (c *Client) Tags(ctx context.Context, repository string) ([]string, error) {
+	repo, err := name.NewRepository(repository)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid repository %q", repository)
+	}
+	tags, err := remote.List(repo, c.options(ctx)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the tags of %s", repository)
+	}
+	return tags, nil
+}
+
+// Delete deletes the tag or the digest of the image from the registry. Registries that do not delete
+// tags get the manifest deleted by digest instead, which removes every tag of the manifest.
+func (c *Client) Delete(ctx context.Context, image string) error {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	if _, ok := ref.(name.Tag); ok {
+		desc, err := remote.Head(ref, c.options(ctx)...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the digest of %s", image)
+		}
+		if err := remote.Delete(ref, c.options(ctx)...); err == nil {
+			return nil
+		}
+		ref = ref.Context().Digest(desc.Digest.String())
+	}
+	if err := remote.Delete(ref, c.options(ctx)...); err != nil {
+		return errors.Wrapf(err, "failed to delete %s", image)
+	}
+	return nil
+}
+
+// Local returns the image from the local docker daemon, which is reached through its API rather than
+// the docker CLI
+func Local(ctx context.Context, image string) (v1.Image, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	img, err := daemon.Image(ref, daemon.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s from the docker daemon", image)
+	}
+	return img, nil
+}
+
+// Host returns the registry host of the image, docker.io for Docker Hub images
+func Host(image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", image)
+	}
+	return NormalizeHost(ref.Context().RegistryStr()), nil
+}
+
+// NormalizeHost returns the host of a registry address without its scheme and path, with the aliases
+// of Docker Hub normalized to docker.io
+func NormalizeHost(address string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(address, "https://"), "http://")
+	host = strings.SplitN(host, "/", 2)[0]
+	switch host {
+	case name.DefaultRegistry, "registry-1.docker.io", "docker.io":
+		return "docker.io"
+	}
+	return host
+}
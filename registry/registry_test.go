@@ -0,0 +1,253 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+)
+
+// newHandler returns an in-memory registry that does not log the requests
+func newHandler() http.Handler {
+	return ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+}
+
+// newRegistry starts an in-process registry and returns its host
+func newRegistry(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	s := httptest.NewServer(handler)
+	t.Cleanup(s.Close)
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func TestClient_PushTagDigest(t *testing.T) {
+	ctx := context.Background()
+	host := newRegistry(t, newHandler())
+	client := New(Options{})
+	image := host + "/acme/web"
+
+	exists, err := client.Exists(ctx, image)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	want, err := img.Digest()
+	require.NoError(t, err)
+
+	digest, err := client.Push(ctx, img, image)
+	require.NoError(t, err)
+	require.Equal(t, want.String(), digest)
+
+	exists, err = client.Exists(ctx, image)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	tagged, err := client.Tag(ctx, image, "1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, digest, tagged)
+
+	got, err := client.Digest(ctx, image+":1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, digest, got)
+
+	_, err = client.Digest(ctx, image+":missing")
+	require.Error(t, err)
+}
+
+func TestClient_Copy(t *testing.T) {
+	ctx := context.Background()
+	src, dst := newRegistry(t, newHandler()), newRegistry(t, newHandler())
+	client := New(Options{})
+
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	digest, err := client.Push(ctx, img, src+"/acme/web:1.0.0")
+	require.NoError(t, err)
+
+	idx, err := random.Index(512, 1, 2)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(src + "/acme/multi:1.0.0")
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(ref, idx))
+	idxDigest, err := idx.Digest()
+	require.NoError(t, err)
+
+	cases := []struct {
+		repo   string
+		digest string
+	}{
+		{"acme/web", digest},
+		{"acme/multi", idxDigest.String()},
+	}
+	for _, tc := range cases {
+		t.Run(tc.repo, func(t *testing.T) {
+			copied, err := client.Copy(ctx, src+"/"+tc.repo+":1.0.0", dst+"/mirror/"+tc.repo+":1.0.0")
+			require.NoError(t, err)
+			require.Equal(t, tc.digest, copied)
+
+			got, err := client.Digest(ctx, dst+"/mirror/"+tc.repo+":1.0.0")
+			require.NoError(t, err)
+			require.Equal(t, tc.digest, got)
+		})
+	}
+
+	_, err = client.Copy(ctx, src+"/acme/missing:1.0.0", dst+"/acme/missing:1.0.0")
+	require.Error(t, err)
+}
+
+func TestClient_TagsDelete(t *testing.T) {
+	ctx := context.Background()
+	host := newRegistry(t, newHandler())
+	client := New(Options{})
+	repo := host + "/acme/web"
+
+	for _, tag := range []string{"1", "2"} {
+		img, err := random.Image(256, 1)
+		require.NoError(t, err)
+		_, err = client.Push(ctx, img, repo+":"+tag)
+		require.NoError(t, err)
+	}
+	_, err := client.Tag(ctx, repo+":2", "latest")
+	require.NoError(t, err)
+
+	tags, err := client.Tags(ctx, repo)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"1", "2", "latest"}, tags)
+
+	require.NoError(t, client.Delete(ctx, repo+":1"))
+	exists, err := client.Exists(ctx, repo+":1")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	exists, err = client.Exists(ctx, repo+":2")
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func TestClient_DockerConfigCredentials(t *testing.T) {
+	ctx := context.Background()
+	reg := newHandler()
+	host := newRegistry(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "eve" || pass != "s3cret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	img, err := random.Image(512, 1)
+	require.NoError(t, err)
+
+	// without credentials the registry rejects the push
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	_, err = New(Options{}).Push(ctx, img, host+"/acme/web:latest")
+	require.Error(t, err)
+
+	dir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("eve:s3cret"))
+	config := fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, host, auth)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600))
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	_, err = New(Options{}).Push(ctx, img, host+"/acme/web:latest")
+	require.NoError(t, err)
+}
+
+func TestHost(t *testing.T) {
+	cases := []struct {
+		image  string
+		expect string
+	}{
+		{"nginx", "docker.io"},
+		{"acme/web:1.0.0", "docker.io"},
+		{"docker.io/acme/web", "docker.io"},
+		{"index.docker.io/acme/web", "docker.io"},
+		{"ghcr.io/acme/web@sha256:" + strings.Repeat("a", 64), "ghcr.io"},
+		{"localhost:5000/web", "localhost:5000"},
+	}
+	for _, tc := range cases {
+		host, err := Host(tc.image)
+		require.NoError(t, err)
+		require.Equal(t, tc.expect, host, tc.image)
+	}
+	_, err := Host("Invalid Image")
+	require.Error(t, err)
+
+	require.Equal(t, "ghcr.io", NormalizeHost("https://ghcr.io/v2/"))
+	require.Equal(t, "docker.io", NormalizeHost("https://index.docker.io/v1/"))
+}
+
+func TestWithLayerProgress(t *testing.T) {
+	ctx := context.Background()
+	host := newRegistry(t, newHandler())
+	client := New(Options{})
+
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	read := map[string]int64{}
+	progress := WithLayerProgress(img, func(layer v1.Hash, n int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		read[layer.String()] = n
+	})
+	_, err = client.Push(ctx, progress, host+"/acme/web:1.0.0")
+	require.NoError(t, err)
+	for _, l := range layers {
+		digest, err := l.Digest()
+		require.NoError(t, err)
+		size, err := l.Size()
+		require.NoError(t, err)
+		require.Equal(t, size, read[digest.String()])
+	}
+
+	// the layers are in the registry, so pushing another tag reads none of them
+	read = map[string]int64{}
+	_, err = client.Push(ctx, progress, host+"/acme/web:1.0.1")
+	require.NoError(t, err)
+	require.Empty(t, read)
+}
+
+func TestWithLabels(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	labels := map[string]string{"org.opencontainers.image.revision": "3f2a9c1"}
+
+	labeled, changed, err := WithLabels(img, labels)
+	require.NoError(t, err)
+	require.True(t, changed)
+	cf, err := labeled.ConfigFile()
+	require.NoError(t, err)
+	require.Equal(t, labels, cf.Config.Labels)
+
+	// the layers are unchanged
+	want, err := img.Layers()
+	require.NoError(t, err)
+	got, err := labeled.Layers()
+	require.NoError(t, err)
+	require.Len(t, got, len(want))
+
+	same, changed, err := WithLabels(labeled, labels)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Equal(t, labeled, same)
+}
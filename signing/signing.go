@@ -0,0 +1,231 @@
+// Package signing signs and verifies image digests with a local ECDSA P-256 keypair.
+//
+// The signatures follow the cosign format: the signed payload is a simple signing document of the
+// image digest, and signatures stored in a registry are images tagged sha256-<hex>.sig in the
+// repository of the signed image. They can be verified with
+//
+//	cosign verify --key eve.pub --insecure-ignore-tlog <image>@<digest>
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PayloadMediaType is the media type of the layers of signature images
+	PayloadMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SignatureAnnotation is the layer annotation that holds the base64 encoded signature
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// payloadType is the type of the simple signing documents of cosign
+	payloadType = "cosign container image signature"
+)
+
+// Signature is a signed payload
+type Signature struct {
+	// Payload is the simple signing document
+	Payload []byte `json:"payload"`
+	// Signature is the base64 encoded ASN.1 ECDSA signature of the SHA-256 of the payload
+	Signature string `json:"signature"`
+}
+
+// payload is the simple signing document of an image digest
+type payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]string `json:"optional"`
+}
+
+// GenerateKey writes a new private key to privPath, readable by the owner only, and its public key to
+// pubPath, both PEM encoded
+func GenerateKey(privPath, pubPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate the key")
+	}
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		path  string
+		block *pem.Block
+		perm  os.FileMode
+	}{
+		{privPath, &pem.Block{Type: "PRIVATE KEY", Bytes: priv}, 0600},
+		{pubPath, &pem.Block{Type: "PUBLIC KEY", Bytes: pub}, 0644},
+	} {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.path, pem.EncodeToMemory(f.block), f.perm); err != nil {
+			return errors.Wrapf(err, "failed to write %s", f.path)
+		}
+	}
+	return nil
+}
+
+// ParsePrivateKey parses a PEM encoded ECDSA private key
+func ParsePrivateKey(b []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, errors.Errorf("unsupported private key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid private key")
+	}
+	ec, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the private key is not an ECDSA key")
+	}
+	return ec, nil
+}
+
+// ParsePublicKey parses a PEM encoded ECDSA public key
+func ParsePublicKey(b []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid public key")
+	}
+	ec, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("the public key is not an ECDSA key")
+	}
+	return ec, nil
+}
+
+// Sign signs the digest of the image in the repository
+func Sign(key *ecdsa.PrivateKey, repository, digest string) (*Signature, error) {
+	var p payload
+	p.Critical.Identity.DockerReference = repository
+	p.Critical.Image.DockerManifestDigest = digest
+	p.Critical.Type = payloadType
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign")
+	}
+	return &Signature{Payload: b, Signature: base64.StdEncoding.EncodeToString(sig)}, nil
+}
+
+// Verify returns an error unless the signature is valid for the key and signs the digest. The
+// repository of the payload is not checked, so images keep their signatures when they are mirrored.
+func (s *Signature) Verify(key *ecdsa.PublicKey, digest string) error {
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return errors.Wrap(err, "invalid signature encoding")
+	}
+	sum := sha256.Sum256(s.Payload)
+	if !ecdsa.VerifyASN1(key, sum[:], sig) {
+		return errors.New("invalid signature")
+	}
+	var p payload
+	if err := json.Unmarshal(s.Payload, &p); err != nil {
+		return errors.Wrap(err, "invalid signature payload")
+	}
+	if p.Critical.Type != payloadType {
+		return errors.Errorf("unexpected signature type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != digest {
+		return errors.Errorf("the signature is for %s, not %s", p.Critical.Image.DockerManifestDigest, digest)
+	}
+	return nil
+}
+
+// Tag returns the tag of the signature image of the digest
+func Tag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// Image returns the signature image with the signatures, one layer each
+func Image(sigs []*Signature) (v1.Image, error) {
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	for _, s := range sigs {
+		var err error
+		img, err = mutate.Append(img, mutate.Addendum{
+			Layer:       static.NewLayer(s.Payload, PayloadMediaType),
+			Annotations: map[string]string{SignatureAnnotation: s.Signature},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// Signatures returns the signatures of the signature image
+func Signatures(img v1.Image) ([]*Signature, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the signature manifest")
+	}
+	var sigs []*Signature
+	for _, desc := range manifest.Layers {
+		sig, ok := desc.Annotations[SignatureAnnotation]
+		if !ok || desc.MediaType != PayloadMediaType {
+			continue
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, &Signature{Payload: b, Signature: sig})
+	}
+	return sigs, nil
+}
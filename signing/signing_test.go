@@ -0,0 +1,125 @@
+package signing
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ovrclk/eve/registry"
+)
+
+const digest = "sha256:46ec07c94ebf45b68ed755c39b90d23f439396f4cee8b9229e213d69e22b9bd7"
+
+func newKeys(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	priv, pub := filepath.Join(dir, "keys", "eve.key"), filepath.Join(dir, "eve.pub")
+	require.NoError(t, GenerateKey(priv, pub))
+	return priv, pub
+}
+
+func TestSignVerify(t *testing.T) {
+	privPath, pubPath := newKeys(t)
+	info, err := os.Stat(privPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	b, err := os.ReadFile(privPath)
+	require.NoError(t, err)
+	priv, err := ParsePrivateKey(b)
+	require.NoError(t, err)
+	b, err = os.ReadFile(pubPath)
+	require.NoError(t, err)
+	pub, err := ParsePublicKey(b)
+	require.NoError(t, err)
+
+	sig, err := Sign(priv, "ghcr.io/acme/web", digest)
+	require.NoError(t, err)
+	require.Contains(t, string(sig.Payload), `"docker-manifest-digest":"`+digest+`"`)
+	require.NoError(t, sig.Verify(pub, digest))
+
+	// another digest
+	require.Error(t, sig.Verify(pub, "sha256:"+digest[len(digest)-64:len(digest)-1]+"0"))
+
+	// another key
+	_, otherPubPath := newKeys(t)
+	b, err = os.ReadFile(otherPubPath)
+	require.NoError(t, err)
+	other, err := ParsePublicKey(b)
+	require.NoError(t, err)
+	require.Error(t, sig.Verify(other, digest))
+
+	// tampered payload
+	tampered := *sig
+	tampered.Payload = append([]byte{}, sig.Payload...)
+	tampered.Payload[len(tampered.Payload)-2] = ' '
+	require.Error(t, tampered.Verify(pub, digest))
+
+	_, err = ParsePublicKey([]byte("not a key"))
+	require.Error(t, err)
+	_, err = ParsePrivateKey(b)
+	require.Error(t, err)
+}
+
+func TestImage(t *testing.T) {
+	privPath, pubPath := newKeys(t)
+	b, _ := os.ReadFile(privPath)
+	priv, err := ParsePrivateKey(b)
+	require.NoError(t, err)
+	b, _ = os.ReadFile(pubPath)
+	pub, err := ParsePublicKey(b)
+	require.NoError(t, err)
+
+	first, err := Sign(priv, "ghcr.io/acme/web", digest)
+	require.NoError(t, err)
+	second, err := Sign(priv, "docker.io/acme/web", digest)
+	require.NoError(t, err)
+	img, err := Image([]*Signature{first, second})
+	require.NoError(t, err)
+
+	sigs, err := Signatures(img)
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+	for _, s := range sigs {
+		require.NoError(t, s.Verify(pub, digest))
+	}
+	require.Equal(t, "sha256-46ec07c94ebf45b68ed755c39b90d23f439396f4cee8b9229e213d69e22b9bd7.sig", Tag(digest))
+}
+
+func TestRegistryRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer s.Close()
+	repo := strings.TrimPrefix(s.URL, "http://") + "/acme/web"
+	client := registry.New(registry.Options{})
+
+	privPath, pubPath := newKeys(t)
+	b, _ := os.ReadFile(privPath)
+	priv, err := ParsePrivateKey(b)
+	require.NoError(t, err)
+	b, _ = os.ReadFile(pubPath)
+	pub, err := ParsePublicKey(b)
+	require.NoError(t, err)
+
+	sig, err := Sign(priv, repo, digest)
+	require.NoError(t, err)
+	img, err := Image([]*Signature{sig})
+	require.NoError(t, err)
+	_, err = client.Push(ctx, img, repo+":"+Tag(digest))
+	require.NoError(t, err)
+
+	pulled, err := client.Image(ctx, repo+":"+Tag(digest))
+	require.NoError(t, err)
+	sigs, err := Signatures(pulled)
+	require.NoError(t, err)
+	require.Len(t, sigs, 1)
+	require.NoError(t, sigs[0].Verify(pub, digest))
+}
@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// PhasePrefix is the prefix of the phase headings
+var PhasePrefix = "====> "
+
+// PhaseIndent is the indentation of the output of a phase under its heading
+var PhaseIndent = "      "
+
+// PhaseTailLines is the number of last output lines a phase keeps
+var PhaseTailLines = 20
+
+// Phase is a UI component that renders a heading followed by the indented output of a
+// step, for example:
+//
+//	====> Packaging
+//	      ...
+//	====> Packing Complete. Image ready ovrclk/web
+//
+// Phase implements io.Writer. Carriage returns are treated as line breaks and lines are
+// written once they are complete.
+type Phase struct {
+	w    io.Writer
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	tail []string
+}
+
+// NewPhase writes the heading to the writer and returns the phase
+func NewPhase(w io.Writer, heading string) *Phase {
+	fmt.Fprintln(w, PhasePrefix+heading)
+	return &Phase{w: w}
+}
+
+// Write writes the complete lines of b indented under the heading
+func (p *Phase) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf.Write(b)
+	for {
+		data := p.buf.Bytes()
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			return len(b), nil
+		}
+		line := string(data[:i])
+		p.buf.Next(i + 1)
+		if line == "" {
+			continue
+		}
+		if err := p.writeLine(line); err != nil {
+			return len(b), err
+		}
+	}
+}
+
+func (p *Phase) writeLine(line string) error {
+	p.tail = append(p.tail, line)
+	if len(p.tail) > PhaseTailLines {
+		p.tail = p.tail[len(p.tail)-PhaseTailLines:]
+	}
+	_, err := fmt.Fprintln(p.w, PhaseIndent+line)
+	return err
+}
+
+// Flush writes the incomplete last line, if any
+func (p *Phase) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if line := strings.TrimSpace(p.buf.String()); line != "" {
+		p.writeLine(line)
+	}
+	p.buf.Reset()
+}
+
+// Tail returns the last output lines of the phase
+func (p *Phase) Tail() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.tail...)
+}
+
+// Done flushes the output and writes the closing heading
+func (p *Phase) Done(heading string) {
+	p.Flush()
+	fmt.Fprintln(p.w, PhasePrefix+heading)
+}
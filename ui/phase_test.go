@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPhase(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPhase(&buf, "Packaging")
+	p.Write([]byte("step 1\nstep"))
+	p.Write([]byte(" 2\r\n50%\r100%\nlast"))
+	p.Done("Packing Complete")
+
+	expect := "====> Packaging\n" +
+		"      step 1\n" +
+		"      step 2\n" +
+		"      50%\n" +
+		"      100%\n" +
+		"      last\n" +
+		"====> Packing Complete\n"
+	if got := buf.String(); got != expect {
+		t.Fatal("== expected\n", expect, "== got\n", got)
+	}
+}
+
+func TestPhase_Tail(t *testing.T) {
+	p := NewPhase(&bytes.Buffer{}, "Publishing")
+	for i := 0; i < PhaseTailLines+5; i++ {
+		p.Write([]byte(strings.Repeat("x", i) + "\n"))
+	}
+	tail := p.Tail()
+	if len(tail) != PhaseTailLines {
+		t.Fatalf("expected %d lines, got %d", PhaseTailLines, len(tail))
+	}
+	if tail[0] != strings.Repeat("x", 5) {
+		t.Fatalf("expected the first lines to be dropped, got %q", tail[0])
+	}
+}
@@ -0,0 +1,211 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ovrclk/eve/pkg/strutil/gytes"
+)
+
+// ProgressInterval is the interval of the one-line updates of a progress that is not on a terminal
+var ProgressInterval = 5 * time.Second
+
+// progressRedraw is the interval of the redraws of a progress on a terminal
+const progressRedraw = 200 * time.Millisecond
+
+// progressBarWidth is the number of characters of a layer progress bar
+const progressBarWidth = 20
+
+// Progress is a UI component that renders the progress of a push, for example:
+//
+//	3f2a9c1d4e5b [=========>          ]  12.30 MB / 24.60 MB
+//	8a1b2c3d4e5f [====================]   1.20 MB / 1.20 MB
+//	Pushed 13.50 MB / 25.80 MB, 1/2 layers, 2.10 MB/s
+//
+// On a terminal the layers are redrawn in place and cleared by Stop. Otherwise a line with the totals
+// is written at each ProgressInterval. Summary writes the final state either way.
+type Progress struct {
+	w        io.Writer
+	terminal bool
+
+	mu     sync.Mutex
+	layers []*progressLayer
+	index  map[string]*progressLayer
+	start  time.Time
+	drawn  int
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type progressLayer struct {
+	digest       string
+	size         int64
+	uncompressed int64
+	read         int64
+	started      bool
+}
+
+// NewProgress returns a progress that writes to w, which is a terminal when terminal is true
+func NewProgress(w io.Writer, terminal bool) *Progress {
+	return &Progress{w: w, terminal: terminal, index: map[string]*progressLayer{}}
+}
+
+// AddLayer adds a layer of the compressed size and the uncompressed size, zero when unknown
+func (p *Progress) AddLayer(digest string, size, uncompressed int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.index[digest]; ok {
+		return
+	}
+	l := &progressLayer{digest: digest, size: size, uncompressed: uncompressed}
+	p.layers = append(p.layers, l)
+	p.index[digest] = l
+}
+
+// Update sets the number of bytes of the layer that are pushed
+func (p *Progress) Update(digest string, read int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if l, ok := p.index[digest]; ok {
+		l.read, l.started = read, true
+	}
+}
+
+// Start renders the progress until Stop is called
+func (p *Progress) Start() {
+	p.mu.Lock()
+	p.start = time.Now()
+	p.stop, p.done = make(chan struct{}), make(chan struct{})
+	p.mu.Unlock()
+
+	interval := ProgressInterval
+	if p.terminal {
+		interval = progressRedraw
+	}
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.render()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops rendering and clears the progress on a terminal
+func (p *Progress) Stop() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.terminal && p.drawn > 0 {
+		fmt.Fprintf(p.w, "\x1b[%dA\x1b[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+func (p *Progress) render() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.terminal {
+		fmt.Fprintln(p.w, p.totalsLine())
+		return
+	}
+	var b strings.Builder
+	if p.drawn > 0 {
+		// move to the first line of the last render
+		fmt.Fprintf(&b, "\x1b[%dA", p.drawn)
+	}
+	for _, l := range p.layers {
+		fmt.Fprintf(&b, "\x1b[2K%s%s %s %10s / %s\n", PhaseIndent, shortDigest(l.digest), bar(l.read, l.size),
+			gytes.Format(uint64(l.read)), gytes.Format(uint64(l.size)))
+	}
+	fmt.Fprintf(&b, "\x1b[2K%s%s\n", PhaseIndent, p.totalsLine())
+	p.drawn = len(p.layers) + 1
+	io.WriteString(p.w, b.String())
+}
+
+// totalsLine returns the pushed and total sizes, the layers that are pushed and the transfer rate
+func (p *Progress) totalsLine() string {
+	var read, size int64
+	complete := 0
+	for _, l := range p.layers {
+		read += l.read
+		size += l.size
+		if l.started && l.read >= l.size {
+			complete++
+		}
+	}
+	rate := uint64(0)
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = uint64(float64(read) / elapsed)
+	}
+	return fmt.Sprintf("Pushed %s / %s, %d/%d layers, %s/s", gytes.Format(uint64(read)), gytes.Format(uint64(size)),
+		complete, len(p.layers), gytes.Format(rate))
+}
+
+// Summary writes the final totals and the compressed and uncompressed sizes of each layer and of the
+// image, layers that the push did not read were already in the registry
+func (p *Progress) Summary(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(w, p.totalsLine())
+	var size, uncompressed, pushed int64
+	for _, l := range p.layers {
+		status := "pushed"
+		if !l.started {
+			status = "exists"
+		} else {
+			pushed += l.size
+		}
+		fmt.Fprintf(w, "%s  %10s compressed  %10s uncompressed  %s\n", shortDigest(l.digest),
+			gytes.Format(uint64(l.size)), formatSize(l.uncompressed), status)
+		size += l.size
+		uncompressed += l.uncompressed
+	}
+	fmt.Fprintf(w, "Image size %s compressed, %s uncompressed, %s pushed in %s\n", gytes.Format(uint64(size)),
+		formatSize(uncompressed), gytes.Format(uint64(pushed)), time.Since(p.start).Round(100*time.Millisecond))
+}
+
+// formatSize formats the size, unknown sizes are zero
+func formatSize(size int64) string {
+	if size <= 0 {
+		return "-"
+	}
+	return gytes.Format(uint64(size))
+}
+
+// shortDigest returns the first 12 hex characters of the digest
+func shortDigest(digest string) string {
+	if i := strings.IndexByte(digest, ':'); i >= 0 {
+		digest = digest[i+1:]
+	}
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// bar returns a progress bar of read out of size
+func bar(read, size int64) string {
+	filled := progressBarWidth
+	if size > 0 && read < size {
+		filled = int(read * progressBarWidth / size)
+	}
+	s := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		s += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	return "[" + s + "]"
+}
@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	defer func(d time.Duration) { ProgressInterval = d }(ProgressInterval)
+	ProgressInterval = 10 * time.Millisecond
+
+	var buf bytes.Buffer
+	p := NewProgress(&buf, false)
+	p.AddLayer("sha256:3f2a9c1d4e5b6f7a", 2000, 5000)
+	p.AddLayer("sha256:8a1b2c3d4e5f6a7b", 1000, 0)
+	p.Start()
+	p.Update("sha256:3f2a9c1d4e5b6f7a", 2000)
+	time.Sleep(50 * time.Millisecond)
+	p.Stop()
+
+	line := strings.SplitN(buf.String(), "\n", 2)[0]
+	if !strings.HasPrefix(line, "Pushed 2.00 KB / 3.00 KB, 1/2 layers, ") {
+		t.Fatalf("unexpected update %q", line)
+	}
+
+	var summary bytes.Buffer
+	p.Summary(&summary)
+	lines := strings.Split(strings.TrimSpace(summary.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %q", summary.String())
+	}
+	if !strings.HasPrefix(lines[0], "Pushed 2.00 KB / 3.00 KB, 1/2 layers, ") {
+		t.Fatalf("unexpected final totals %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "3f2a9c1d4e5b") || !strings.HasSuffix(lines[1], "pushed") {
+		t.Fatalf("unexpected layer line %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "exists") || !strings.Contains(lines[2], "- uncompressed") {
+		t.Fatalf("unexpected layer line %q", lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "Image size 3.00 KB compressed, 5.00 KB uncompressed, 2.00 KB pushed in ") {
+		t.Fatalf("unexpected totals %q", lines[3])
+	}
+}
+
+func TestProgress_TerminalClear(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewProgress(&buf, true)
+	p.AddLayer("sha256:3f2a9c1d4e5b6f7a", 2000, 0)
+	p.Start()
+	time.Sleep(3 * progressRedraw / 2)
+	p.Stop()
+	if !strings.HasSuffix(buf.String(), "\x1b[2A\x1b[J") {
+		t.Fatalf("expected the progress to be cleared, got %q", buf.String())
+	}
+}
+
+func TestProgress_Bar(t *testing.T) {
+	for _, tc := range []struct {
+		read, size int64
+		expect     string
+	}{
+		{0, 100, "[>                   ]"},
+		{50, 100, "[==========>         ]"},
+		{100, 100, "[====================]"},
+	} {
+		if got := bar(tc.read, tc.size); got != tc.expect {
+			t.Errorf("bar(%d, %d) = %q, expected %q", tc.read, tc.size, got, tc.expect)
+		}
+	}
+}
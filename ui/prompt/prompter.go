@@ -55,7 +55,7 @@ func (a *Prompter) String(str *string, prompt string) {
 // PromptHiddenString prompts the user for input and hides the input when the string is missing.
 // It used for capturing sensitive data (passwords). Will not prompt when no interactive is true
 func (a *Prompter) HiddenString(str *string, prompt string) error {
-	if a.NoInteractive || len(*str) == 0 {
+	if a.NoInteractive || len(*str) != 0 {
 		return nil
 	}
 	input, err := speakeasy.Ask(prompt)
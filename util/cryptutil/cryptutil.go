@@ -0,0 +1,111 @@
+// Package cryptutil provides helpers to encrypt and decrypt small payloads,
+// such as secrets, that eve stores in the state directory.
+package cryptutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KeySize is the size of the encryption key in bytes (AES-256).
+const KeySize = 32
+
+// KeyEnv is the environment variable that can hold a hex encoded key. When set,
+// it takes precedence over the key file.
+const KeyEnv = "EVE_SECRETS_KEY"
+
+// NewKey returns a new random key.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrap(err, "failed to generate key")
+	}
+	return key, nil
+}
+
+// LoadKey reads the hex encoded key from the KeyEnv environment variable or
+// from the given file. When neither exists, a new key is generated and
+// written to the file with owner only permissions.
+func LoadKey(filename string) ([]byte, error) {
+	if val, ok := os.LookupEnv(KeyEnv); ok {
+		return decodeKey(val)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err == nil {
+		return decodeKey(string(b))
+	}
+	if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to read key file %s", filename)
+	}
+
+	key, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to create key directory for %s", filename)
+	}
+	if err := os.WriteFile(filename, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		return nil, errors.Wrapf(err, "failed to write key file %s", filename)
+	}
+	return key, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.Wrap(err, "key is not hex encoded")
+	}
+	if len(key) != KeySize {
+		return nil, errors.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Encrypt encrypts the plaintext using AES-GCM. The random nonce is prepended
+// to the returned ciphertext.
+func Encrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt decrypts the ciphertext produced by Encrypt.
+func Decrypt(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt, is the key correct?")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid key")
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,61 @@
+package cryptutil
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("s3cr3t")
+	ciphertext, err := Encrypt(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Fatal("ciphertext contains the plaintext")
+	}
+	got, err := Decrypt(key, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("expected %q, got %q", plaintext, got)
+	}
+
+	other, _ := NewKey()
+	if _, err := Decrypt(other, ciphertext); err == nil {
+		t.Fatal("expected an error decrypting with the wrong key")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	t.Setenv(KeyEnv, "")
+	filename := filepath.Join(t.TempDir(), "eve", "secrets.key")
+	if _, err := LoadKey(filename); err == nil {
+		t.Fatal("expected an error for an invalid key in the environment")
+	}
+}
+
+func TestLoadKey_generates(t *testing.T) {
+	if _, ok := os.LookupEnv(KeyEnv); ok {
+		t.Skipf("%s is set", KeyEnv)
+	}
+	filename := filepath.Join(t.TempDir(), "eve", "secrets.key")
+	first, err := LoadKey(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadKey(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("expected the generated key to be persisted")
+	}
+}
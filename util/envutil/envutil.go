@@ -0,0 +1,321 @@
+// Package envutil parses dotenv files.
+//
+// The supported syntax is:
+//
+//	# comments and blank lines are ignored
+//	export KEY=value          # the export prefix is optional
+//	KEY=unquoted value        # inline comments need a preceding space
+//	KEY='single quoted'       # literal, may span multiple lines
+//	KEY="double \"quoted\"\n" # escapes, may span multiple lines
+//	KEY=${OTHER}/bin          # expands earlier keys, then the environment
+//	KEY=${OTHER:-default}     # default when OTHER is unset or empty
+//	KEY                       # the value is taken from the environment
+//
+// Expansion applies to unquoted and double quoted values.
+package envutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseFile parses the dotenv file. Variables are expanded using the environment of the
+// current process.
+func ParseFile(filename string) (map[string]string, error) {
+	b, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %s", filename)
+	}
+	env, err := Parse(string(b), os.LookupEnv)
+	if err != nil {
+		return nil, errors.Wrap(err, filename)
+	}
+	return env, nil
+}
+
+// Parse parses the dotenv contents. The lookup function resolves the variables that are not
+// defined earlier in the contents.
+func Parse(s string, lookup func(string) (string, bool)) (map[string]string, error) {
+	p := &parser{src: strings.ReplaceAll(s, "\r\n", "\n"), line: 1, env: map[string]string{}, lookup: lookup}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.env, nil
+}
+
+// Error is a parse error at a line
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+type parser struct {
+	src    string
+	pos    int
+	line   int
+	env    map[string]string
+	lookup func(string) (string, bool)
+}
+
+func (p *parser) errorf(line int, format string, v ...interface{}) error {
+	return &Error{Line: line, Msg: fmt.Sprintf(format, v...)}
+}
+
+func (p *parser) parse() error {
+	for p.pos < len(p.src) {
+		p.skipSpace()
+		switch {
+		case p.pos >= len(p.src):
+			return nil
+		case p.src[p.pos] == '\n':
+			p.pos++
+			p.line++
+			continue
+		case p.src[p.pos] == '#':
+			p.skipLine()
+			continue
+		}
+		if err := p.parseEntry(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseEntry() error {
+	line := p.line
+	if strings.HasPrefix(p.src[p.pos:], "export ") || strings.HasPrefix(p.src[p.pos:], "export\t") {
+		p.pos += len("export")
+		p.skipSpace()
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && isKeyChar(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	key := p.src[start:p.pos]
+	if key == "" {
+		return p.errorf(line, "invalid variable name starting with %q", p.peekRest())
+	}
+	p.skipSpace()
+
+	// value-less form, the value is taken from the environment
+	if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == '#' {
+		p.skipLine()
+		if v, ok := p.lookup(key); ok {
+			p.env[key] = v
+		} else {
+			p.env[key] = ""
+		}
+		return nil
+	}
+	if p.src[p.pos] != '=' {
+		return p.errorf(line, "expected '=' after %s, got %q", key, p.peekRest())
+	}
+	p.pos++
+	p.skipSpace()
+
+	var value string
+	var err error
+	switch {
+	case p.pos < len(p.src) && p.src[p.pos] == '\'':
+		value, err = p.parseSingleQuoted(line)
+	case p.pos < len(p.src) && p.src[p.pos] == '"':
+		value, err = p.parseDoubleQuoted(line)
+	default:
+		value, err = p.parseUnquoted(line)
+	}
+	if err != nil {
+		return err
+	}
+	p.env[key] = value
+	return nil
+}
+
+func (p *parser) parseSingleQuoted(line int) (string, error) {
+	p.pos++ // opening quote
+	end := strings.IndexByte(p.src[p.pos:], '\'')
+	if end < 0 {
+		return "", p.errorf(line, "unterminated single quoted value")
+	}
+	value := p.src[p.pos : p.pos+end]
+	p.line += strings.Count(value, "\n")
+	p.pos += end + 1
+	return value, p.endOfValue()
+}
+
+func (p *parser) parseDoubleQuoted(line int) (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return "", p.errorf(line, "unterminated double quoted value")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), p.endOfValue()
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				return "", p.errorf(p.line, "unterminated double quoted value")
+			}
+			p.pos++
+			switch e := p.src[p.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\', '$', '\'':
+				b.WriteByte(e)
+			case '\n':
+				// line continuation
+				p.line++
+			default:
+				return "", p.errorf(p.line, "invalid escape sequence \\%c", e)
+			}
+			p.pos++
+		case '$':
+			v, err := p.expand()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *parser) parseUnquoted(line int) (string, error) {
+	var b strings.Builder
+	for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		c := p.src[p.pos]
+		if c == '#' && (p.pos == 0 || p.src[p.pos-1] == ' ' || p.src[p.pos-1] == '\t') {
+			p.skipLine()
+			break
+		}
+		if c == '$' {
+			v, err := p.expand()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(v)
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// expand expands the $VAR or ${VAR} reference at the current position
+func (p *parser) expand() (string, error) {
+	p.pos++ // $
+	if p.pos < len(p.src) && p.src[p.pos] == '{' {
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end < 0 || strings.Contains(p.src[p.pos:p.pos+end], "\n") {
+			return "", p.errorf(p.line, "unterminated variable reference")
+		}
+		ref := p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		name, def, hasDefault := strings.Cut(ref, ":-")
+		if !isKey(name) {
+			return "", p.errorf(p.line, "invalid variable reference ${%s}", ref)
+		}
+		if v := p.resolve(name); v != "" || !hasDefault {
+			return v, nil
+		}
+		return def, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && isKeyChar(p.src[p.pos], p.pos == start) && p.src[p.pos] != '.' && p.src[p.pos] != '-' {
+		p.pos++
+	}
+	if start == p.pos {
+		// a lone dollar sign
+		return "$", nil
+	}
+	return p.resolve(p.src[start:p.pos]), nil
+}
+
+func (p *parser) resolve(name string) string {
+	if v, ok := p.env[name]; ok {
+		return v
+	}
+	if v, ok := p.lookup(name); ok {
+		return v
+	}
+	return ""
+}
+
+// endOfValue makes sure only whitespace or a comment follows a quoted value
+func (p *parser) endOfValue() error {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '#' {
+		return p.errorf(p.line, "unexpected %q after the quoted value", p.peekRest())
+	}
+	p.skipLine()
+	return nil
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// skipLine moves to the start of the next line
+func (p *parser) skipLine() {
+	for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		p.pos++
+	}
+	if p.pos < len(p.src) {
+		p.pos++
+		p.line++
+	}
+}
+
+func (p *parser) peekRest() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		return p.src[p.pos:]
+	}
+	return p.src[p.pos : p.pos+end]
+}
+
+func isKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isKeyChar(s[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isKeyChar(c byte, first bool) bool {
+	switch {
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9' || c == '.' || c == '-':
+		return !first
+	}
+	return false
+}
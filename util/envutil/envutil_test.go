@@ -0,0 +1,83 @@
+package envutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	environ := map[string]string{"HOME": "/home/eve", "EMPTY": ""}
+	lookup := func(k string) (string, bool) {
+		v, ok := environ[k]
+		return v, ok
+	}
+
+	cases := []struct {
+		name   string
+		in     string
+		expect map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"simple", "FOO=bar\nBAZ=qux", map[string]string{"FOO": "bar", "BAZ": "qux"}},
+		{"comments and blanks", "# comment\n\n  # indented\nFOO=bar\n", map[string]string{"FOO": "bar"}},
+		{"inline comment", "FOO=bar # comment\nBAR=a#b", map[string]string{"FOO": "bar", "BAR": "a#b"}},
+		{"export", "export FOO=bar\nexport\tBAR=baz", map[string]string{"FOO": "bar", "BAR": "baz"}},
+		{"spaces around equals", "FOO = bar  ", map[string]string{"FOO": "bar"}},
+		{"empty value", "FOO=\nBAR= # comment", map[string]string{"FOO": "", "BAR": ""}},
+		{"value with equals", "URL=postgres://u:p@h/db?ssl=true", map[string]string{"URL": "postgres://u:p@h/db?ssl=true"}},
+		{"single quotes", `FOO='bar # baz $HOME \n'`, map[string]string{"FOO": `bar # baz $HOME \n`}},
+		{"double quotes", `FOO="bar # baz"`, map[string]string{"FOO": "bar # baz"}},
+		{"double quote escapes", `FOO="a\"b\\c\nd\te\$HOME"`, map[string]string{"FOO": "a\"b\\c\nd\te$HOME"}},
+		{"multiline double quotes", "KEY=\"-----BEGIN-----\nabc\n-----END-----\"\nNEXT=1", map[string]string{"KEY": "-----BEGIN-----\nabc\n-----END-----", "NEXT": "1"}},
+		{"multiline single quotes", "KEY='a\nb'", map[string]string{"KEY": "a\nb"}},
+		{"expand environment", "P=${HOME}/bin:$HOME", map[string]string{"P": "/home/eve/bin:/home/eve"}},
+		{"expand earlier key", "A=1\nB=${A}2\nC=\"$B-3\"", map[string]string{"A": "1", "B": "12", "C": "12-3"}},
+		{"expand default", "A=${MISSING:-x}\nB=${EMPTY:-y}\nC=${HOME:-z}", map[string]string{"A": "x", "B": "y", "C": "/home/eve"}},
+		{"expand missing", "A=${MISSING}", map[string]string{"A": ""}},
+		{"lone dollar", "A=5$\nB=$ 1", map[string]string{"A": "5$", "B": "$ 1"}},
+		{"value-less", "HOME\nMISSING", map[string]string{"HOME": "/home/eve", "MISSING": ""}},
+		{"crlf", "A=1\r\nB=2\r\n", map[string]string{"A": "1", "B": "2"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.in, lookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expect) {
+				t.Fatalf("expected %q, got %q", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	lookup := func(string) (string, bool) { return "", false }
+
+	cases := []struct {
+		name string
+		in   string
+		line int
+	}{
+		{"invalid key", "A=1\n1A=2", 2},
+		{"missing equals", "A=1\n\nFOO bar", 3},
+		{"unterminated double quote", "A=1\nB=\"abc\n\n", 2},
+		{"unterminated single quote", "A='abc", 1},
+		{"trailing characters", "A=1\nB=\"abc\" def", 2},
+		{"invalid escape", "A=\"a\nb\\q\"", 2},
+		{"unterminated reference", "A=1\nB=${C\nD=1", 2},
+		{"invalid reference", "A=${1B}", 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.in, lookup)
+			perr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("expected a parse error, got %v", err)
+			}
+			if perr.Line != tc.line {
+				t.Fatalf("expected an error at line %d, got %v", tc.line, err)
+			}
+		})
+	}
+}
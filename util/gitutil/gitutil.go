@@ -0,0 +1,79 @@
+// Package gitutil runs git to inspect and check out repositories.
+package gitutil
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Checkout clones the repository at url, a remote URL or a local path, into dir and checks out
+// the ref, which is a commit SHA, a tag or a branch. It returns the SHA of the checked out commit.
+func Checkout(ctx context.Context, url, ref, dir string) (string, error) {
+	if _, err := git(ctx, "", "clone", "--quiet", "--no-checkout", url, dir); err != nil {
+		return "", errors.Wrapf(err, "failed to clone %s", url)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// resolve branches against the remote so that a local branch of the same name is not required
+	sha, err := git(ctx, dir, "rev-parse", "--verify", "--quiet", "origin/"+ref+"^{commit}")
+	if err != nil {
+		if sha, err = git(ctx, dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+			return "", errors.Errorf("ref %s not found in %s", ref, url)
+		}
+	}
+	if _, err := git(ctx, dir, "checkout", "--quiet", "--detach", sha); err != nil {
+		return "", errors.Wrapf(err, "failed to check out %s", ref)
+	}
+	if _, err := git(ctx, dir, "submodule", "update", "--quiet", "--init", "--recursive"); err != nil {
+		return "", errors.Wrap(err, "failed to check out submodules")
+	}
+	return sha, nil
+}
+
+// Head returns the SHA of the commit checked out at dir and whether tracked files have changes
+func Head(ctx context.Context, dir string) (sha string, dirty bool, err error) {
+	if sha, err = git(ctx, dir, "rev-parse", "HEAD"); err != nil {
+		return "", false, err
+	}
+	status, err := git(ctx, dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return "", false, err
+	}
+	return sha, status != "", nil
+}
+
+// Describe returns the most recent tag reachable from the commit checked out at dir, followed by the
+// number of commits since the tag and the abbreviated SHA when the commit is not tagged
+func Describe(ctx context.Context, dir string) (string, error) {
+	tag, err := git(ctx, dir, "describe", "--tags")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to describe the commit")
+	}
+	return tag, nil
+}
+
+// ShortSHA returns the abbreviated form of the SHA
+func ShortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", errors.Errorf("git %s: %s", args[len(args)-1], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
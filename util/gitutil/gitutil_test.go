@@ -0,0 +1,122 @@
+package gitutil
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newBareRepo creates a bare repository with a main branch of two commits, a v1 tag on the first
+// commit and a feature branch. It returns the path to the repository and the SHAs of the commits.
+func newBareRepo(t *testing.T) (string, map[string]string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	work, bare := filepath.Join(root, "work"), filepath.Join(root, "repo.git")
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=eve", "GIT_AUTHOR_EMAIL=eve@example.com",
+			"GIT_COMMITTER_NAME=eve", "GIT_COMMITTER_EMAIL=eve@example.com")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(work, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shas := map[string]string{}
+	run(root, "init", "--quiet", "--initial-branch=main", work)
+	write("app.txt", "v1")
+	run(work, "add", ".")
+	run(work, "commit", "--quiet", "-m", "v1")
+	run(work, "tag", "v1")
+	shas["v1"], _, _ = Head(context.Background(), work)
+	run(work, "checkout", "--quiet", "-b", "feature")
+	write("app.txt", "feature")
+	run(work, "commit", "--quiet", "-am", "feature")
+	shas["feature"], _, _ = Head(context.Background(), work)
+	run(work, "checkout", "--quiet", "main")
+	write("app.txt", "v2")
+	run(work, "commit", "--quiet", "-am", "v2")
+	shas["main"], _, _ = Head(context.Background(), work)
+	run(root, "clone", "--quiet", "--bare", work, bare)
+	return bare, shas
+}
+
+func TestCheckout(t *testing.T) {
+	repo, shas := newBareRepo(t)
+	cases := []struct {
+		ref     string
+		sha     string
+		content string
+	}{
+		{"", shas["main"], "v2"},
+		{"main", shas["main"], "v2"},
+		{"v1", shas["v1"], "v1"},
+		{"feature", shas["feature"], "feature"},
+		{shas["v1"], shas["v1"], "v1"},
+		{ShortSHA(shas["feature"]), shas["feature"], "feature"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.ref, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "checkout")
+			sha, err := Checkout(context.Background(), repo, tc.ref, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sha != tc.sha {
+				t.Fatalf("expected %s, got %s", tc.sha, sha)
+			}
+			b, err := os.ReadFile(filepath.Join(dir, "app.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.content {
+				t.Fatalf("expected %q, got %q", tc.content, b)
+			}
+		})
+	}
+
+	if _, err := Checkout(context.Background(), repo, "missing", filepath.Join(t.TempDir(), "checkout")); err == nil {
+		t.Fatal("expected an error for a missing ref")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	repo, _ := newBareRepo(t)
+	cases := []struct {
+		ref    string
+		prefix string
+	}{
+		{"v1", "v1"},
+		{"main", "v1-1-g"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.ref, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "checkout")
+			if _, err := Checkout(context.Background(), repo, tc.ref, dir); err != nil {
+				t.Fatal(err)
+			}
+			tag, err := Describe(context.Background(), dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(tag, tc.prefix) || (tc.ref == "v1" && tag != "v1") {
+				t.Fatalf("expected %s, got %s", tc.prefix, tag)
+			}
+		})
+	}
+}
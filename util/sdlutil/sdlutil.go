@@ -0,0 +1,392 @@
+// Package sdlutil edits Akash SDL documents through yaml.v3 node trees so that comments,
+// anchors and key order of the source survive a rewrite.
+package sdlutil
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Indent is the number of spaces used to indent the written documents
+var Indent = 2
+
+// Document is a parsed SDL document
+type Document struct {
+	root yaml.Node
+}
+
+// Parse parses the SDL document
+func Parse(b []byte) (*Document, error) {
+	d := &Document{}
+	if err := yaml.Unmarshal(b, &d.root); err != nil {
+		return nil, errors.Wrap(err, "failed to parse SDL")
+	}
+	if d.mapping() == nil {
+		return nil, errors.New("SDL must be a YAML mapping")
+	}
+	return d, nil
+}
+
+// Bytes returns the YAML encoding of the document
+func (d *Document) Bytes() ([]byte, error) {
+	// the encoder writes the merge keys it decoded as !!merge <<
+	untagMerges(&d.root)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(Indent)
+	if err := enc.Encode(&d.root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Format normalizes the formatting of the SDL document
+func Format(b []byte) ([]byte, error) {
+	d, err := Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	return d.Bytes()
+}
+
+// Services returns the names of the services in the order they are declared
+func (d *Document) Services() []string {
+	services := resolve(Lookup(d.mapping(), "services"))
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil
+	}
+	names := make([]string, 0, len(services.Content)/2)
+	for i := 0; i < len(services.Content); i += 2 {
+		names = append(names, services.Content[i].Value)
+	}
+	return names
+}
+
+// Service returns the mapping node of the service
+func (d *Document) Service(name string) (*yaml.Node, error) {
+	services := resolve(Lookup(d.mapping(), "services"))
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil, errors.New("no services defined in the SDL")
+	}
+	svc := resolve(Lookup(services, name))
+	if svc == nil || svc.Kind != yaml.MappingNode {
+		return nil, errors.Errorf("service %s not found in the SDL", name)
+	}
+	return svc, nil
+}
+
+// Image returns the image of the service
+func (d *Document) Image(service string) (string, error) {
+	svc, err := d.Service(service)
+	if err != nil {
+		return "", err
+	}
+	if img := resolve(Lookup(svc, "image")); img != nil {
+		return img.Value, nil
+	}
+	return "", nil
+}
+
+// SetImage sets the image of the service
+func (d *Document) SetImage(service, image string) error {
+	svc, err := d.ownService(service)
+	if err != nil {
+		return err
+	}
+	Set(svc, "image", Scalar(image))
+	return nil
+}
+
+// Env returns the KEY=VALUE env entries of the service
+func (d *Document) Env(service string) ([]string, error) {
+	svc, err := d.Service(service)
+	if err != nil {
+		return nil, err
+	}
+	env := resolve(Lookup(svc, "env"))
+	if env == nil || env.Kind != yaml.SequenceNode {
+		return nil, nil
+	}
+	out := make([]string, 0, len(env.Content))
+	for _, e := range env.Content {
+		out = append(out, e.Value)
+	}
+	return out, nil
+}
+
+// SetEnv sets the KEY=VALUE entry in the env of the service, replacing the existing entry
+// for the key in place. The edit only applies to the service: an env that aliases an anchor is
+// copied before it is edited, and the services that alias an anchored env get their own copy of
+// it first.
+func (d *Document) SetEnv(service, key, value string) error {
+	svc, err := d.ownService(service)
+	if err != nil {
+		return err
+	}
+	env := d.own(svc, "env")
+	if env == nil || env.Kind != yaml.SequenceNode {
+		env = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		Set(svc, "env", env)
+	}
+	entry := key + "=" + value
+	for _, e := range env.Content {
+		if strings.SplitN(e.Value, "=", 2)[0] == key {
+			e.Value, e.Tag, e.Style = entry, "!!str", 0
+			return nil
+		}
+	}
+	env.Content = append(env.Content, Scalar(entry))
+	return nil
+}
+
+// SetCommand sets the command and the args of the service, an empty list removes the key
+func (d *Document) SetCommand(service string, command, args []string) error {
+	svc, err := d.ownService(service)
+	if err != nil {
+		return err
+	}
+	for _, kv := range []struct {
+		key    string
+		values []string
+	}{{"command", command}, {"args", args}} {
+		if len(kv.values) == 0 {
+			unset(svc, kv.key)
+			continue
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, v := range kv.values {
+			seq.Content = append(seq.Content, Scalar(v))
+		}
+		Set(svc, kv.key, seq)
+	}
+	return nil
+}
+
+// SetCredentials sets the credentials the provider uses to pull the image of the service from a
+// private registry
+func (d *Document) SetCredentials(service, host, username, password string) error {
+	svc, err := d.ownService(service)
+	if err != nil {
+		return err
+	}
+	creds := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	Set(creds, "host", Scalar(host))
+	Set(creds, "username", Scalar(username))
+	Set(creds, "password", Scalar(password))
+	Set(svc, "credentials", creds)
+	return nil
+}
+
+// DeleteKey removes the key from the service. A key the service merges from another mapping is set
+// to null instead, as the merged value would still apply.
+func (d *Document) DeleteKey(service, key string) error {
+	svc, err := d.ownService(service)
+	if err != nil {
+		return err
+	}
+	unset(svc, key)
+	return nil
+}
+
+// CloneService adds the service dst as a copy of the service src, including its deployment. The
+// copy shares the compute profile and the pricing of src. An existing dst is replaced.
+func (d *Document) CloneService(src, dst string) error {
+	svc, err := d.Service(src)
+	if err != nil {
+		return err
+	}
+	c := clone(svc)
+	c.Anchor = ""
+	Set(resolve(Lookup(d.mapping(), "services")), dst, c)
+
+	deployment := resolve(Lookup(d.mapping(), "deployment"))
+	if dep := resolve(Lookup(deployment, src)); dep != nil {
+		c := clone(dep)
+		c.Anchor = ""
+		Set(deployment, dst, c)
+	}
+	return nil
+}
+
+// ownService returns the mapping node of the service for an edit that must not apply to other
+// services. A service that aliases an anchor is replaced by a copy, and the services that alias
+// the anchored service get their own copy.
+func (d *Document) ownService(name string) (*yaml.Node, error) {
+	if _, err := d.Service(name); err != nil {
+		return nil, err
+	}
+	return d.own(resolve(Lookup(d.mapping(), "services")), name), nil
+}
+
+// own returns the value of the key in the mapping node so that it can be edited without editing
+// the values that share it through an anchor. An alias, or a value merged from another mapping, is
+// replaced by a copy of its node, and the aliases of an anchored value are replaced by copies before
+// it is returned.
+func (d *Document) own(m *yaml.Node, key string) *yaml.Node {
+	n := lookup(m, key)
+	if n == nil {
+		if n = Lookup(m, key); n == nil {
+			return nil
+		}
+		c := clone(resolve(n))
+		c.Anchor = ""
+		Set(m, key, c)
+		return c
+	}
+	if n.Kind == yaml.AliasNode {
+		c := clone(resolve(n))
+		c.Anchor = ""
+		Set(m, key, c)
+		return c
+	}
+	if n.Anchor != "" {
+		detach(&d.root, n)
+		n.Anchor = ""
+	}
+	return n
+}
+
+// detach replaces the aliases of the anchored node under n by copies of the node
+func detach(n, anchored *yaml.Node) {
+	for i, child := range n.Content {
+		if child.Kind == yaml.AliasNode && child.Alias == anchored {
+			c := clone(anchored)
+			c.Anchor = ""
+			c.HeadComment, c.LineComment = child.HeadComment, child.LineComment
+			n.Content[i] = c
+			continue
+		}
+		detach(child, anchored)
+	}
+}
+
+func (d *Document) mapping() *yaml.Node {
+	if d.root.Kind != yaml.DocumentNode || len(d.root.Content) == 0 {
+		return nil
+	}
+	m := resolve(d.root.Content[0])
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	return m
+}
+
+// Lookup returns the value of the key in the mapping node, nil if it is missing. Keys of the mapping
+// take precedence over the keys it merges with <<, which are looked up in order.
+func Lookup(m *yaml.Node, key string) *yaml.Node {
+	if n := lookup(m, key); n != nil {
+		return n
+	}
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if !isMerge(m.Content[i]) {
+			continue
+		}
+		sources := []*yaml.Node{m.Content[i+1]}
+		if v := resolve(m.Content[i+1]); v.Kind == yaml.SequenceNode {
+			sources = v.Content
+		}
+		for _, src := range sources {
+			if n := Lookup(resolve(src), key); n != nil {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+// lookup returns the value of the key of the mapping node itself, ignoring merge keys
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key && !isMerge(m.Content[i]) {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// isMerge returns true for the merge key <<
+func isMerge(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.Value == "<<" && (key.Tag == "!!merge" || key.Tag == "")
+}
+
+// untagMerges clears the tag of the merge keys under n
+func untagMerges(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if isMerge(n.Content[i]) {
+				n.Content[i].Tag = ""
+			}
+		}
+	}
+	for _, child := range n.Content {
+		untagMerges(child)
+	}
+}
+
+// unset removes the key from the mapping node, or sets it to null when the mapping merges it
+func unset(m *yaml.Node, key string) {
+	Delete(m, key)
+	if Lookup(m, key) != nil {
+		Set(m, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"})
+	}
+}
+
+// Set sets the value of the key in the mapping node, keeping the position of an existing
+// key and appending new keys at the end
+func Set(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			// keep the comments attached to the previous value
+			value.HeadComment = m.Content[i+1].HeadComment
+			value.LineComment = m.Content[i+1].LineComment
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, Scalar(key), value)
+}
+
+// Delete removes the key from the mapping node
+func Delete(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// Scalar returns a string scalar node
+func Scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// clone returns a deep copy of the node
+func clone(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = clone(child)
+	}
+	return &c
+}
+
+// resolve follows aliases to the anchored node
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
@@ -0,0 +1,267 @@
+package sdlutil
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSDL = `# deployment of the ecosystem site
+version: "2.0"
+services:
+  web:
+    image: ovrclk/web:1 # replaced on deploy
+    env: &env
+      - A=1
+    expose:
+      - port: 80
+  db:
+    image: postgres
+    env: *env
+profiles: {}
+`
+
+func TestDocument(t *testing.T) {
+	d, err := Parse([]byte(testSDL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(d.Services(), ","); got != "web,db" {
+		t.Fatalf("expected services in source order, got %s", got)
+	}
+	if err := d.SetImage("web", "ovrclk/web:2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetEnv("web", "A", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetEnv("web", "B", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetEnv("db", "C", "4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetImage("api", "x"); err == nil {
+		t.Fatal("expected an error for a missing service")
+	}
+
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, expect := range []string{
+		"# deployment of the ecosystem site\n",
+		"image: ovrclk/web:2 # replaced on deploy\n",
+		"env:\n      - A=2\n      - B=3\n",
+		"env:\n      - A=1\n      - C=4\n",
+	} {
+		if !strings.Contains(got, expect) {
+			t.Errorf("expected output to contain %q, got:\n%s", expect, got)
+		}
+	}
+	if strings.Index(got, "version") > strings.Index(got, "services") {
+		t.Errorf("expected key order to be preserved, got:\n%s", got)
+	}
+}
+
+func TestDocument_SetEnvAnchorScope(t *testing.T) {
+	for _, order := range [][]string{{"web", "db"}, {"db", "web"}} {
+		d, err := Parse([]byte(strings.Replace(testSDL, "  db:\n", "  worker: &worker\n    image: worker\n  jobs: *worker\n  db:\n", 1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a secret scoped to one service must not reach the services sharing its env or its definition
+		for _, name := range order {
+			if err := d.SetEnv(name, "SECRET_"+strings.ToUpper(name), "s3cr3t"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.SetEnv("jobs", "QUEUE", "jobs"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Bytes(); err != nil {
+			t.Fatal(err)
+		}
+		for service, expect := range map[string]string{
+			"web":    "A=1,SECRET_WEB=s3cr3t",
+			"db":     "A=1,SECRET_DB=s3cr3t",
+			"worker": "",
+			"jobs":   "QUEUE=jobs",
+		} {
+			env, err := d.Env(service)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(env, ","); got != expect {
+				t.Errorf("order %v: expected the env of %s to be %q, got %q", order, service, expect, got)
+			}
+		}
+	}
+}
+
+const testMergeSDL = `x-base: &base
+  image: app
+  env:
+    - A=1
+    - B=2
+  expose:
+    - port: 80
+services:
+  web:
+    <<: *base
+  db:
+    <<: [*base]
+    image: postgres
+`
+
+func TestDocument_SetEnvMerge(t *testing.T) {
+	d, err := Parse([]byte(testMergeSDL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetEnv("web", "B", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetEnv("db", "SECRET", "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteKey("db", "expose"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the merged env is copied into each service before it is edited, the base is unchanged
+	expect := `x-base: &base
+  image: app
+  env:
+    - A=1
+    - B=2
+  expose:
+    - port: 80
+services:
+  web:
+    <<: *base
+    env:
+      - A=1
+      - B=3
+  db:
+    <<: [*base]
+    image: postgres
+    env:
+      - A=1
+      - B=2
+      - SECRET=s3cr3t
+    expose: null
+`
+	if string(b) != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, b)
+	}
+	if img, err := d.Image("web"); err != nil || img != "app" {
+		t.Fatalf("expected the merged image app, got %q, %v", img, err)
+	}
+}
+
+func TestFormat_MergeKeys(t *testing.T) {
+	got, err := Format([]byte(testMergeSDL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != testMergeSDL {
+		t.Fatalf("expected:\n%s\ngot:\n%s", testMergeSDL, got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got, err := Format([]byte("version: '2.0'\nservices:\n    web:\n        image: nginx  # web\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "version: '2.0'\nservices:\n  web:\n    image: nginx # web\n"
+	if string(got) != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, got)
+	}
+}
+
+func TestDocument_CloneService(t *testing.T) {
+	d, err := Parse([]byte(`services:
+  web:
+    image: app
+    expose:
+      - port: 80
+deployment:
+  web:
+    akash:
+      profile: web
+      count: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CloneService("web", "web-worker"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteKey("web-worker", "expose"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetCommand("web-worker", []string{"/cnb/process/worker"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `services:
+  web:
+    image: app
+    expose:
+      - port: 80
+  web-worker:
+    image: app
+    command:
+      - /cnb/process/worker
+deployment:
+  web:
+    akash:
+      profile: web
+      count: 1
+  web-worker:
+    akash:
+      profile: web
+      count: 1
+`
+	if string(b) != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, b)
+	}
+}
+
+func TestDocument_SetCredentials(t *testing.T) {
+	d, err := Parse([]byte(`services:
+  web:
+    image: ghcr.io/acme/web
+    credentials:
+      host: old
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetCredentials("web", "ghcr.io", "eve", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `services:
+  web:
+    image: ghcr.io/acme/web
+    credentials:
+      host: ghcr.io
+      username: eve
+      password: s3cret
+`
+	if string(b) != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, b)
+	}
+}
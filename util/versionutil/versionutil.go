@@ -0,0 +1,163 @@
+// Package versionutil generates and validates the versions of published images.
+//
+// The strategies are:
+//
+//	timestamp # the Unix time, such as 1666051200
+//	git-sha   # the abbreviated SHA of the built commit, such as 3f2a9c1d4e5b
+//	git-tag   # the output of git describe --tags, such as v1.2.0 or v1.2.0-3-g3f2a9c1
+//	semver    # the latest semantic version bumped by major, minor or patch, such as 1.3.0
+//	template  # a Go template of the Data fields, such as {{.Date}}-{{.ShortSHA}}
+package versionutil
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Strategies
+const (
+	Timestamp = "timestamp"
+	GitSHA    = "git-sha"
+	GitTag    = "git-tag"
+	Semver    = "semver"
+	Template  = "template"
+)
+
+// Semver parts to bump
+const (
+	Major = "major"
+	Minor = "minor"
+	Patch = "patch"
+)
+
+// tagPattern is the grammar of image tags
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// semverPattern matches versions of the form [v]MAJOR.MINOR.PATCH
+var semverPattern = regexp.MustCompile(`^(v?)(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)$`)
+
+// Data is the information available to the strategies
+type Data struct {
+	// Timestamp is the Unix time of the publish
+	Timestamp int64
+	// Date is the UTC date of the publish in the form 20060102
+	Date string
+	// SHA and ShortSHA are the built commit and its abbreviation, empty outside of git
+	SHA      string
+	ShortSHA string
+	// Tag is the output of git describe --tags, empty without tags
+	Tag string
+	// Latest is the greatest semantic version in the release history, empty without one
+	Latest string
+	// Environment is the name of the environment
+	Environment string
+}
+
+// Generate returns the version of the strategy. The bump applies to the semver strategy and the
+// template to the template strategy.
+func Generate(strategy, bump, tmpl string, data Data) (string, error) {
+	var version string
+	switch strategy {
+	case Timestamp:
+		version = strconv.FormatInt(data.Timestamp, 10)
+	case GitSHA:
+		if data.ShortSHA == "" {
+			return "", errors.New("the git-sha version strategy requires a git commit")
+		}
+		version = data.ShortSHA
+	case GitTag:
+		if data.Tag == "" {
+			return "", errors.New("the git-tag version strategy requires a git tag")
+		}
+		version = data.Tag
+	case Semver:
+		latest := data.Latest
+		if latest == "" {
+			latest = "0.0.0"
+		}
+		var err error
+		if version, err = Bump(latest, bump); err != nil {
+			return "", err
+		}
+	case Template:
+		if tmpl == "" {
+			return "", errors.New("the template version strategy requires a template")
+		}
+		t, err := template.New("version").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return "", errors.Wrap(err, "invalid version template")
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return "", errors.Wrap(err, "failed to render the version template")
+		}
+		version = strings.TrimSpace(buf.String())
+	default:
+		return "", errors.Errorf("unknown version strategy %q, expected one of %s", strategy, strings.Join(Strategies(), ", "))
+	}
+	if err := Validate(version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// Strategies returns the names of the strategies
+func Strategies() []string {
+	return []string{Timestamp, GitSHA, GitTag, Semver, Template}
+}
+
+// Validate returns an error when the version is not a valid image tag
+func Validate(version string) error {
+	if !tagPattern.MatchString(version) {
+		return errors.Errorf("invalid version %q, versions are image tags of up to 128 letters, digits, '_', '.' and '-'", version)
+	}
+	return nil
+}
+
+// Bump increments the part, major, minor or patch, of the semantic version and resets the lower
+// parts. A v prefix is kept.
+func Bump(version, part string) (string, error) {
+	m := semverPattern.FindStringSubmatch(version)
+	if m == nil {
+		return "", errors.Errorf("%q is not a semantic version", version)
+	}
+	major, _ := strconv.Atoi(m[2])
+	minor, _ := strconv.Atoi(m[3])
+	patch, _ := strconv.Atoi(m[4])
+	switch part {
+	case Major:
+		major, minor, patch = major+1, 0, 0
+	case Minor:
+		minor, patch = minor+1, 0
+	case Patch, "":
+		patch++
+	default:
+		return "", errors.Errorf("unknown semver part %q, expected major, minor or patch", part)
+	}
+	return fmt.Sprintf("%s%d.%d.%d", m[1], major, minor, patch), nil
+}
+
+// Latest returns the greatest semantic version of the versions, or an empty string when none is one
+func Latest(versions []string) string {
+	latest, key := "", [3]int{-1, -1, -1}
+	for _, v := range versions {
+		m := semverPattern.FindStringSubmatch(v)
+		if m == nil {
+			continue
+		}
+		var k [3]int
+		for i := range k {
+			k[i], _ = strconv.Atoi(m[i+2])
+		}
+		if k[0] > key[0] || (k[0] == key[0] && (k[1] > key[1] || (k[1] == key[1] && k[2] > key[2]))) {
+			latest, key = v, k
+		}
+	}
+	return latest
+}
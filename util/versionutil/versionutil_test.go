@@ -0,0 +1,89 @@
+package versionutil
+
+import (
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	data := Data{
+		Timestamp:   1666051200,
+		Date:        "20221018",
+		SHA:         "3f2a9c1d4e5b6a7f8091a2b3c4d5e6f708192a3b",
+		ShortSHA:    "3f2a9c1d4e5b",
+		Tag:         "v1.2.0-3-g3f2a9c1",
+		Latest:      "v1.2.0",
+		Environment: "staging",
+	}
+	cases := []struct {
+		name     string
+		strategy string
+		bump     string
+		tmpl     string
+		data     Data
+		expect   string
+		err      bool
+	}{
+		{"timestamp", Timestamp, "", "", data, "1666051200", false},
+		{"git sha", GitSHA, "", "", data, "3f2a9c1d4e5b", false},
+		{"git sha outside of git", GitSHA, "", "", Data{}, "", true},
+		{"git tag", GitTag, "", "", data, "v1.2.0-3-g3f2a9c1", false},
+		{"git tag without tags", GitTag, "", "", Data{}, "", true},
+		{"semver patch", Semver, "", "", data, "v1.2.1", false},
+		{"semver minor", Semver, Minor, "", data, "v1.3.0", false},
+		{"semver major", Semver, Major, "", data, "v2.0.0", false},
+		{"semver first", Semver, Minor, "", Data{}, "0.1.0", false},
+		{"semver invalid part", Semver, "build", "", data, "", true},
+		{"template", Template, "", "{{.Environment}}-{{.Date}}-{{.ShortSHA}}", data, "staging-20221018-3f2a9c1d4e5b", false},
+		{"template missing field", Template, "", "{{.Branch}}", data, "", true},
+		{"template invalid tag", Template, "", "{{.Date}}/{{.ShortSHA}}", data, "", true},
+		{"template empty", Template, "", "", data, "", true},
+		{"unknown", "calver", "", "", data, "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := Generate(tc.strategy, tc.bump, tc.tmpl, tc.data)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != tc.expect {
+				t.Fatalf("expected %q, got %q", tc.expect, version)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, v := range []string{"1.0.0", "v1", "1666051200", "a_b-c.d"} {
+		if err := Validate(v); err != nil {
+			t.Errorf("expected %q to be valid: %v", v, err)
+		}
+	}
+	for _, v := range []string{"", ".hidden", "-dash", "a/b", "a:b", string(make([]byte, 129))} {
+		if err := Validate(v); err == nil {
+			t.Errorf("expected %q to be invalid", v)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	cases := []struct {
+		versions []string
+		expect   string
+	}{
+		{nil, ""},
+		{[]string{"1666051200", "3f2a9c1d4e5b"}, ""},
+		{[]string{"1.2.0", "1.10.0", "1.9.3", "latest"}, "1.10.0"},
+		{[]string{"v0.1.0", "v0.0.9", "v1.0.0-rc1"}, "v0.1.0"},
+	}
+	for _, tc := range cases {
+		if got := Latest(tc.versions); got != tc.expect {
+			t.Errorf("Latest(%v): expected %q, got %q", tc.versions, tc.expect, got)
+		}
+	}
+}